@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Pipeline - jobs built from a text description like
+//
+//	SingleHash | MultiHash | CombineResults
+//
+// Stages are separated by "|" or new lines, a stage is a registered
+// name followed by its arguments ("batch 10", `filter match "^4"`),
+// lines starting with # are comments
+type Pipeline struct {
+	Stages  []string
+	Jobs    []job
+	Metrics *Metrics
+	Dead    *DeadLetters
+	Remote  *Coordinator
+}
+
+type stageFactory func(p *Pipeline, args []string) (job, error)
+
+var stages = map[string]stageFactory{}
+
+// RegisterStage makes a stage available for Parse under the name
+func RegisterStage(name string, factory stageFactory) {
+	stages[name] = factory
+}
+
+// StageNames - sorted names of the registered stages
+func StageNames() []string {
+	names := make([]string, 0, len(stages))
+	for name := range stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Parse(spec string) (*Pipeline, error) {
+	p := &Pipeline{Dead: &DeadLetters{}}
+
+	for _, line := range strings.Split(spec, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		for _, stage := range strings.Split(line, "|") {
+			words, err := splitWords(stage)
+			if err != nil {
+				return nil, fmt.Errorf("stage %q: %v", strings.TrimSpace(stage), err)
+			}
+			if len(words) == 0 {
+				continue
+			}
+
+			factory, ok := stages[words[0]]
+			if !ok {
+				return nil, fmt.Errorf("unknown stage %q", words[0])
+			}
+			worker, err := factory(p, words[1:])
+			if err != nil {
+				return nil, fmt.Errorf("stage %s: %v", words[0], err)
+			}
+
+			p.Stages = append(p.Stages, words[0])
+			p.Jobs = append(p.Jobs, worker)
+		}
+	}
+
+	if len(p.Jobs) == 0 {
+		return nil, fmt.Errorf("empty pipeline")
+	}
+	return p, nil
+}
+
+// splitWords splits a stage by spaces, double quoted words are unquoted
+func splitWords(stage string) ([]string, error) {
+	words := []string{}
+	rest := strings.TrimSpace(stage)
+
+	for rest != "" {
+		var word string
+		if rest[0] == '"' {
+			end := 1
+			for end < len(rest) && (rest[end] != '"' || rest[end-1] == '\\') {
+				end++
+			}
+			if end == len(rest) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			var err error
+			if word, err = strconv.Unquote(rest[:end+1]); err != nil {
+				return nil, err
+			}
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end == -1 {
+				end = len(rest)
+			}
+			word, rest = rest[:end], rest[end:]
+		}
+
+		words = append(words, word)
+		rest = strings.TrimSpace(rest)
+	}
+
+	return words, nil
+}
+
+// Run executes the pipeline between the source and the sink jobs
+func (p *Pipeline) Run(source, sink job) {
+	jobs := append([]job{source}, p.Jobs...)
+	jobs = append(jobs, sink)
+
+	if p.Metrics != nil {
+		names := append([]string{"source"}, p.Stages...)
+		jobs = p.Metrics.InstrumentNamed(append(names, "sink"), jobs...)
+	}
+
+	ExecutePipeline(jobs...)
+}
+
+// ReadLines - source job, a line is sent as int if it is a number
+func ReadLines(r io.Reader) job {
+	return func(in, out chan interface{}) {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if num, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+				out <- num
+			} else {
+				out <- line
+			}
+		}
+	}
+}
+
+// WriteLines - sink job, prints every value on its own line
+func WriteLines(w io.Writer) job {
+	return func(in, out chan interface{}) {
+		buf := bufio.NewWriter(w)
+		for data := range in {
+			fmt.Fprintln(buf, data)
+		}
+		buf.Flush()
+	}
+}
+
+var mapFuncs = map[string]func(interface{}) interface{}{
+	"upper": func(v interface{}) interface{} { return strings.ToUpper(fmt.Sprint(v)) },
+	"lower": func(v interface{}) interface{} { return strings.ToLower(fmt.Sprint(v)) },
+	"trim":  func(v interface{}) interface{} { return strings.TrimSpace(fmt.Sprint(v)) },
+	"str":   func(v interface{}) interface{} { return fmt.Sprint(v) },
+	"len":   func(v interface{}) interface{} { return len(fmt.Sprint(v)) },
+}
+
+type filterFactory func(args []string) (func(interface{}) bool, error)
+
+var filterFuncs = map[string]filterFactory{
+	"nonempty": func(args []string) (func(interface{}) bool, error) {
+		return func(v interface{}) bool { return fmt.Sprint(v) != "" }, nil
+	},
+	"contains": func(args []string) (func(interface{}) bool, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("contains needs a substring")
+		}
+		return func(v interface{}) bool { return strings.Contains(fmt.Sprint(v), args[0]) }, nil
+	},
+	"match": func(args []string) (func(interface{}) bool, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("match needs a regexp")
+		}
+		r, err := regexp.Compile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) bool { return r.MatchString(fmt.Sprint(v)) }, nil
+	},
+	"even": func(args []string) (func(interface{}) bool, error) {
+		return func(v interface{}) bool { num, ok := v.(int); return ok && num%2 == 0 }, nil
+	},
+	"odd": func(args []string) (func(interface{}) bool, error) {
+		return func(v interface{}) bool { num, ok := v.(int); return ok && num%2 != 0 }, nil
+	},
+}
+
+// RegisterMap adds a function usable as "map <name>"
+func RegisterMap(name string, fn func(interface{}) interface{}) {
+	mapFuncs[name] = fn
+}
+
+// RegisterFilter adds a predicate usable as "filter <name> [args...]"
+func RegisterFilter(name string, factory filterFactory) {
+	filterFuncs[name] = factory
+}
+
+func noArgs(worker job) stageFactory {
+	return func(p *Pipeline, args []string) (job, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("takes no arguments")
+		}
+		return worker, nil
+	}
+}
+
+func positiveArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("needs a size")
+	}
+	size, err := strconv.Atoi(args[0])
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("size must be a positive int, got %q", args[0])
+	}
+	return size, nil
+}
+
+func init() {
+	RegisterStage("CombineResults", noArgs(CombineResults))
+
+	RegisterStage("map", func(p *Pipeline, args []string) (job, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("needs a function name")
+		}
+		fn, ok := mapFuncs[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown map function %q", args[0])
+		}
+		return func(in, out chan interface{}) {
+			for data := range in {
+				out <- fn(data)
+			}
+		}, nil
+	})
+
+	RegisterStage("filter", func(p *Pipeline, args []string) (job, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("needs a predicate name")
+		}
+		factory, ok := filterFuncs[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q", args[0])
+		}
+		keep, err := factory(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return func(in, out chan interface{}) {
+			for data := range in {
+				if keep(data) {
+					out <- data
+				}
+			}
+		}, nil
+	})
+
+	// batch N - groups of N items, the last one may be shorter
+	RegisterStage("batch", func(p *Pipeline, args []string) (job, error) {
+		size, err := positiveArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return CountWindow(size, size, sliceItems), nil
+	})
+
+	// window N - last N items, sent on every item once N are seen
+	RegisterStage("window", func(p *Pipeline, args []string) (job, error) {
+		size, err := positiveArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return CountWindow(size, 1, sliceItems), nil
+	})
+}
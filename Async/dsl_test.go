@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		spec, input, expected string
+	}{
+		{"map upper", "a\nb\n", "A\nB\n"},
+		{`filter match "^1" | map len`, "1\n22\n13\nabc\n", "1\n2\n"},
+		{"filter even\nbatch 2", "1\n2\n4\n6\n8\n", "[2 4]\n[6 8]\n"},
+		{"# sliding\nwindow 2", "1\n2\n3\n", "[1 2]\n[2 3]\n"},
+	}
+
+	for idx, item := range cases {
+		p, err := Parse(item.spec)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		out := new(bytes.Buffer)
+		p.Run(ReadLines(strings.NewReader(item.input)), WriteLines(out))
+		if out.String() != item.expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), item.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for idx, spec := range []string{
+		"",
+		"Unknown",
+		"SingleHash 1",
+		"batch",
+		"window -1",
+		"map nope",
+		`filter match "(`,
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("[%d] expected error for %q", idx, spec)
+		}
+	}
+}
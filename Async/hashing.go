@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Signer - one hashing step of the chain
+type Signer interface {
+	Sign(data string) string
+}
+
+// SignerFunc - adapter to use a plain function as a Signer
+type SignerFunc func(data string) string
+
+func (f SignerFunc) Sign(data string) string {
+	return f(data)
+}
+
+// crc32 and md5 go through the package variables so that
+// DataSignerCrc32 and DataSignerMd5 can still be replaced
+var signers = map[string]Signer{
+	"crc32": SignerFunc(func(data string) string {
+		return DataSignerCrc32(data)
+	}),
+	"md5": SignerFunc(func(data string) string {
+		md5Mu.Lock()
+		defer md5Mu.Unlock()
+		return DataSignerMd5(data)
+	}),
+	"crc32c": SignerFunc(func(data string) string {
+		data += DataSignerSalt
+		return strconv.FormatUint(uint64(crc32.Checksum([]byte(data), castagnoli)), 10)
+	}),
+	"sha256": SignerFunc(func(data string) string {
+		data += DataSignerSalt
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	}),
+	"xxhash": SignerFunc(func(data string) string {
+		data += DataSignerSalt
+		return strconv.FormatUint(xxhash64([]byte(data), 0), 10)
+	}),
+}
+
+// md5 can't be called concurrently (overheat), the signer serializes it
+var md5Mu sync.Mutex
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// signersMu - chains are parsed while pipelines may register signers
+var signersMu sync.RWMutex
+
+// RegisterSigner makes a signer usable in chain formulas under the name
+func RegisterSigner(name string, s Signer) {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	signers[name] = s
+}
+
+// lookupSigner - the registered signer with the name
+func lookupSigner(name string) (Signer, bool) {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	s, ok := signers[name]
+	return s, ok
+}
+
+// SignerNames - sorted names of the registered signers
+func SignerNames() []string {
+	signersMu.RLock()
+	defer signersMu.RUnlock()
+	names := make([]string, 0, len(signers))
+	for name := range signers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain - formulas of SingleHash and MultiHash.
+//
+// A formula is a call of a registered signer on "data", "th" or
+// their concatenation with "+", calls can be nested: "crc32(md5(data))".
+// Parts of a formula separated by "~" are computed concurrently and
+// joined with "~". Multi is computed for th = 0..Threads-1 concurrently
+// and the results are concatenated in order
+type Chain struct {
+	Single  string
+	Multi   string
+	Threads int
+
+	single, multi []signExpr
+}
+
+var ChainPresets = map[string]*Chain{
+	"default": MustChain("crc32(data)~crc32(md5(data))", "crc32(th+data)", 6),
+	"strong":  MustChain("sha256(data)~sha256(md5(data))", "sha256(th+data)", 6),
+	"fast":    MustChain("crc32c(data)~xxhash(data)", "xxhash(th+data)", 6),
+}
+
+// SignChain - chain used by SingleHash and MultiHash
+var SignChain = ChainPresets["default"]
+
+func NewChain(single, multi string, threads int) (*Chain, error) {
+	if threads <= 0 {
+		return nil, fmt.Errorf("threads must be positive, got %d", threads)
+	}
+
+	c := &Chain{Single: single, Multi: multi, Threads: threads}
+	var err error
+	if c.single, err = parseFormula(single); err != nil {
+		return nil, fmt.Errorf("single formula %q: %v", single, err)
+	}
+	if c.multi, err = parseFormula(multi); err != nil {
+		return nil, fmt.Errorf("multi formula %q: %v", multi, err)
+	}
+	return c, nil
+}
+
+func MustChain(single, multi string, threads int) *Chain {
+	c, err := NewChain(single, multi, threads)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (c *Chain) SingleSign(data string) string {
+	return evalParts(c.single, data, "")
+}
+
+func (c *Chain) MultiSign(data string) string {
+	results := make([]string, c.Threads)
+	wg := &sync.WaitGroup{}
+	for th := 0; th < c.Threads; th++ {
+		wg.Add(1)
+		go func(th int) {
+			defer wg.Done()
+			results[th] = evalParts(c.multi, data, strconv.Itoa(th))
+		}(th)
+	}
+	wg.Wait()
+
+	return strings.Join(results, "")
+}
+
+func evalParts(parts []signExpr, data, th string) string {
+	if len(parts) == 1 {
+		return parts[0].eval(data, th)
+	}
+
+	results := make([]string, len(parts))
+	wg := &sync.WaitGroup{}
+	for i, part := range parts {
+		wg.Add(1)
+		go func(i int, part signExpr) {
+			defer wg.Done()
+			results[i] = part.eval(data, th)
+		}(i, part)
+	}
+	wg.Wait()
+
+	return strings.Join(results, "~")
+}
+
+type signExpr interface {
+	eval(data, th string) string
+}
+
+type varExpr string
+
+func (v varExpr) eval(data, th string) string {
+	if v == "th" {
+		return th
+	}
+	return data
+}
+
+type concatExpr []signExpr
+
+func (c concatExpr) eval(data, th string) string {
+	result := ""
+	for _, e := range c {
+		result += e.eval(data, th)
+	}
+	return result
+}
+
+type callExpr struct {
+	signer Signer
+	arg    signExpr
+}
+
+func (c callExpr) eval(data, th string) string {
+	return c.signer.Sign(c.arg.eval(data, th))
+}
+
+func parseFormula(formula string) ([]signExpr, error) {
+	parts := []signExpr{}
+	for _, part := range strings.Split(formula, "~") {
+		p := &formulaParser{src: strings.Replace(part, " ", "", -1)}
+		e, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos != len(p.src) {
+			return nil, fmt.Errorf("unexpected %q", p.src[p.pos:])
+		}
+		parts = append(parts, e)
+	}
+	return parts, nil
+}
+
+type formulaParser struct {
+	src string
+	pos int
+}
+
+func (p *formulaParser) concat() (signExpr, error) {
+	terms := concatExpr{}
+	for {
+		e, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, e)
+
+		if p.pos == len(p.src) || p.src[p.pos] != '+' {
+			break
+		}
+		p.pos++
+	}
+
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *formulaParser) term() (signExpr, error) {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("()+", p.src[p.pos]) == -1 {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+
+	if p.pos == len(p.src) || p.src[p.pos] != '(' {
+		if name != "data" && name != "th" {
+			return nil, fmt.Errorf("expected data, th or a signer call, got %q", name)
+		}
+		return varExpr(name), nil
+	}
+
+	signer, ok := lookupSigner(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown signer %q", name)
+	}
+	p.pos++
+	arg, err := p.concat()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos == len(p.src) || p.src[p.pos] != ')' {
+		return nil, fmt.Errorf("missing ) after %s(", name)
+	}
+	p.pos++
+
+	return callExpr{signer, arg}, nil
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxhash64 - XXH64 of b
+func xxhash64(b []byte, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for len(b) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:]))
+			b = b[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) +
+			bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		for _, v := range []uint64{v1, v2, v3, v4} {
+			h = (h^xxRound(0, v))*xxPrime1 + xxPrime4
+		}
+	} else {
+		h = seed + xxPrime5
+	}
+
+	h += uint64(n)
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	return bits.RotateLeft64(acc+input*xxPrime2, 31) * xxPrime1
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestXXHash(t *testing.T) {
+	cases := []struct {
+		data     string
+		expected uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for idx, item := range cases {
+		if got := xxhash64([]byte(item.data), 0); got != item.expected {
+			t.Errorf("[%d] xxhash64(%q) = %x, expected %x", idx, item.data, got, item.expected)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	// cheap signers to check the formula wiring without the sleeps
+	RegisterSigner("rev", SignerFunc(func(data string) string {
+		runes := []rune(data)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes)
+	}))
+	RegisterSigner("wrap", SignerFunc(func(data string) string { return "<" + data + ">" }))
+	t.Cleanup(func() {
+		signersMu.Lock()
+		defer signersMu.Unlock()
+		delete(signers, "rev")
+		delete(signers, "wrap")
+	})
+
+	chain, err := NewChain("rev(data) ~ wrap(rev(data+data))", "wrap(th+data)", 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := chain.SingleSign("ab"); got != "ba~<baba>" {
+		t.Errorf("single: got %q, expected %q", got, "ba~<baba>")
+	}
+	if got := chain.MultiSign("x"); got != "<0x><1x><2x>" {
+		t.Errorf("multi: got %q, expected %q", got, "<0x><1x><2x>")
+	}
+
+	for idx, formula := range []string{"", "nope(data)", "rev(data", "rev(data))", "rev(body)", "rev()"} {
+		if _, err := NewChain(formula, "rev(th)", 1); err == nil {
+			t.Errorf("[%d] expected error for %q", idx, formula)
+		}
+	}
+	if _, err := NewChain("rev(data)", "rev(th)", 0); err == nil {
+		t.Errorf("expected error for zero threads")
+	}
+
+	// chains are parsed while signers are registered, go test -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			RegisterSigner("wrap", SignerFunc(func(data string) string { return "<" + data + ">" }))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := NewChain("wrap(data)", "wrap(th)", 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// go build -o sign . && sign "SingleHash | MultiHash | CombineResults" < numbers.txt
+func main() {
+	if IsWorker() {
+		if err := RunWorker(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	specFile := flag.String("f", "", "read the pipeline description from a file")
+	metricsAddr := flag.String("metrics", "", "serve /metrics on this address while running")
+	tracePath := flag.String("trace", "", "write per-item spans to this JSON file")
+	preset := flag.String("chain", "default", "signer chain preset for SingleHash and MultiHash")
+	single := flag.String("single", "", "SingleHash formula, e.g. \"crc32(data)~crc32(md5(data))\"")
+	multi := flag.String("multi", "", "MultiHash formula, e.g. \"crc32(th+data)\"")
+	threads := flag.Int("threads", 0, "MultiHash th count")
+	flag.StringVar(&DefaultListen, "listen", DefaultListen, "coordinator address of remote stages, unix:/path or tcp:host:port")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] \"Stage args | Stage ...\" < input\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "stages:", strings.Join(StageNames(), ", "))
+		fmt.Fprintln(os.Stderr, "signers:", strings.Join(SignerNames(), ", "))
+	}
+	flag.Parse()
+
+	spec := strings.Join(flag.Args(), " ")
+	if *specFile != "" {
+		raw, err := ioutil.ReadFile(*specFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		spec = string(raw)
+	}
+	if strings.TrimSpace(spec) == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	chain, ok := ChainPresets[*preset]
+	if !ok {
+		log.Fatalf("unknown chain preset %q", *preset)
+	}
+	if *single != "" || *multi != "" || *threads != 0 {
+		c := *chain
+		if *single != "" {
+			c.Single = *single
+		}
+		if *multi != "" {
+			c.Multi = *multi
+		}
+		if *threads != 0 {
+			c.Threads = *threads
+		}
+		var err error
+		if chain, err = NewChain(c.Single, c.Multi, c.Threads); err != nil {
+			log.Fatal(err)
+		}
+	}
+	SignChain = chain
+
+	p, err := Parse(spec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *metricsAddr != "" || *tracePath != "" {
+		p.Metrics = NewMetrics()
+	}
+	if *tracePath != "" {
+		if err := p.Metrics.TraceTo(*tracePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", p.Metrics)
+		go func() {
+			log.Println(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
+	p.Run(ReadLines(os.Stdin), WriteLines(os.Stdout))
+
+	if p.Remote != nil {
+		p.Remote.Close()
+	}
+	if p.Metrics != nil {
+		if err := p.Metrics.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+	if len(p.Dead.Failures()) > 0 {
+		p.Dead.Report(os.Stderr)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upper bounds (seconds) of the latency histogram buckets, +Inf is implicit
+var latencyBuckets = []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// StageMetrics - counters of one pipeline stage
+//
+// Stages are black boxes (channel in, channel out), so the latency of an
+// output is counted from the first item the stage read after the one of its
+// previous output, or from that output if it read nothing since: it is exact
+// for 1:1 stages handling an item at a time and an approximation for the rest.
+// For a source stage latency is the interval between two outputs
+type StageMetrics struct {
+	Index int
+	Name  string
+
+	in, consumed, out uint64
+
+	mu sync.Mutex
+	// since - when the first item after the last output was read, zero if none
+	since        time.Time
+	lastConsumed time.Time
+	lastOut      time.Time
+	buckets      []uint64
+	sumNanos     int64
+}
+
+func (s *StageMetrics) In() uint64  { return atomic.LoadUint64(&s.in) }
+func (s *StageMetrics) Out() uint64 { return atomic.LoadUint64(&s.out) }
+
+// QueueDepth - items taken from the previous stage and not yet read by this one
+func (s *StageMetrics) QueueDepth() int {
+	// consumed first, so it's never ahead of in
+	consumed := atomic.LoadUint64(&s.consumed)
+	return int(atomic.LoadUint64(&s.in) - consumed)
+}
+
+func (s *StageMetrics) received() {
+	atomic.AddUint64(&s.in, 1)
+}
+
+// consume - the stage has read an item
+func (s *StageMetrics) consume() {
+	atomic.AddUint64(&s.consumed, 1)
+
+	s.mu.Lock()
+	s.lastConsumed = time.Now()
+	if s.since.IsZero() {
+		s.since = s.lastConsumed
+	}
+	s.mu.Unlock()
+}
+
+func (s *StageMetrics) emitted() (seq uint64, start, end time.Time) {
+	seq = atomic.AddUint64(&s.out, 1)
+	end = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case !s.since.IsZero():
+		start = s.since
+	case seq == 1 || s.lastOut.IsZero():
+		start = end
+	default:
+		start = s.lastOut
+	}
+	// the next output is of an item read after this one, if there was such
+	if s.lastConsumed.After(start) {
+		s.since = s.lastConsumed
+	} else {
+		s.since = time.Time{}
+	}
+	s.lastOut = end
+
+	latency := end.Sub(start)
+	s.sumNanos += int64(latency)
+	i := 0
+	for i < len(latencyBuckets) && latency.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	s.buckets[i]++
+
+	return seq, start, end
+}
+
+// Metrics - per-stage instrumentation of a pipeline
+//
+//	m := NewMetrics()
+//	ExecutePipeline(m.Instrument(jobs...)...)
+type Metrics struct {
+	mu     sync.RWMutex
+	stages []*StageMetrics
+	tracer *tracer
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Stages - snapshot of the instrumented stages
+func (m *Metrics) Stages() []*StageMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*StageMetrics{}, m.stages...)
+}
+
+// Instrument wraps every job so that items passing it are counted,
+// timed and (if TraceTo was called) traced
+func (m *Metrics) Instrument(jobs ...job) []job {
+	names := make([]string, len(jobs))
+	for i, worker := range jobs {
+		names[i] = jobName(worker)
+	}
+	return m.InstrumentNamed(names, jobs...)
+}
+
+// InstrumentNamed - Instrument with explicit stage names
+func (m *Metrics) InstrumentNamed(names []string, jobs ...job) []job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wrapped := make([]job, len(jobs))
+	for i, worker := range jobs {
+		stage := &StageMetrics{
+			Index:   len(m.stages),
+			Name:    names[i],
+			buckets: make([]uint64, len(latencyBuckets)+1),
+		}
+		m.stages = append(m.stages, stage)
+		wrapped[i] = m.observe(stage, worker)
+	}
+
+	return wrapped
+}
+
+func (m *Metrics) observe(stage *StageMetrics, worker job) job {
+	return func(in, out chan interface{}) {
+		var innerIn chan interface{}
+		if in != nil {
+			innerIn = make(chan interface{})
+			// not waited: the worker is free to stop reading early
+			go func() {
+				for data := range in {
+					stage.received()
+					innerIn <- data
+					stage.consume()
+				}
+				close(innerIn)
+			}()
+		}
+
+		innerOut := make(chan interface{})
+		done := make(chan struct{})
+		go func() {
+			for data := range innerOut {
+				seq, start, end := stage.emitted()
+				m.trace(stage, seq, start, end)
+				out <- data
+			}
+			close(done)
+		}()
+
+		worker(innerIn, innerOut)
+		close(innerOut)
+		<-done
+	}
+}
+
+// jobName - function name of the job without a package prefix,
+// anonymous jobs are named after the enclosing function
+func jobName(worker job) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(worker).Pointer())
+	if fn == nil {
+		return "job"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// ServeHTTP - metrics in the prometheus text format, mount it as /metrics
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	stages := m.Stages()
+
+	fmt.Fprintln(w, "# HELP pipeline_stage_items_in_total Items received by the stage.")
+	fmt.Fprintln(w, "# TYPE pipeline_stage_items_in_total counter")
+	for _, s := range stages {
+		fmt.Fprintf(w, "pipeline_stage_items_in_total{%s} %d\n", s.labels(), s.In())
+	}
+
+	fmt.Fprintln(w, "# HELP pipeline_stage_items_out_total Items emitted by the stage.")
+	fmt.Fprintln(w, "# TYPE pipeline_stage_items_out_total counter")
+	for _, s := range stages {
+		fmt.Fprintf(w, "pipeline_stage_items_out_total{%s} %d\n", s.labels(), s.Out())
+	}
+
+	fmt.Fprintln(w, "# HELP pipeline_stage_queue_depth Items taken from the previous stage and not yet read.")
+	fmt.Fprintln(w, "# TYPE pipeline_stage_queue_depth gauge")
+	for _, s := range stages {
+		fmt.Fprintf(w, "pipeline_stage_queue_depth{%s} %d\n", s.labels(), s.QueueDepth())
+	}
+
+	fmt.Fprintln(w, "# HELP pipeline_stage_latency_seconds Item processing latency.")
+	fmt.Fprintln(w, "# TYPE pipeline_stage_latency_seconds histogram")
+	for _, s := range stages {
+		s.mu.Lock()
+		var count uint64
+		for i, n := range s.buckets {
+			count += n
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = fmt.Sprint(latencyBuckets[i])
+			}
+			fmt.Fprintf(w, "pipeline_stage_latency_seconds_bucket{%s,le=%q} %d\n", s.labels(), le, count)
+		}
+		fmt.Fprintf(w, "pipeline_stage_latency_seconds_sum{%s} %g\n", s.labels(), time.Duration(s.sumNanos).Seconds())
+		fmt.Fprintf(w, "pipeline_stage_latency_seconds_count{%s} %d\n", s.labels(), count)
+		s.mu.Unlock()
+	}
+}
+
+func (s *StageMetrics) labels() string {
+	return fmt.Sprintf("stage=\"%d\",name=%q", s.Index, s.Name)
+}
+
+type span struct {
+	Stage int       `json:"stage"`
+	Name  string    `json:"name"`
+	Seq   uint64    `json:"seq"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Nanos int64     `json:"duration_ns"`
+}
+
+type tracer struct {
+	sync.Mutex
+	file  *os.File
+	buf   *bufio.Writer
+	enc   *json.Encoder
+	count int
+}
+
+// TraceTo writes a span per emitted item to a JSON file (array of spans),
+// the file is finalized by Close
+func (m *Metrics) TraceTo(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	t := &tracer{file: file, buf: bufio.NewWriter(file)}
+	t.enc = json.NewEncoder(t.buf)
+	t.buf.WriteString("[\n")
+
+	m.mu.Lock()
+	m.tracer = t
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Metrics) trace(stage *StageMetrics, seq uint64, start, end time.Time) {
+	m.mu.RLock()
+	t := m.tracer
+	m.mu.RUnlock()
+	if t == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	if t.count > 0 {
+		t.buf.WriteString(",")
+	}
+	t.count++
+	t.enc.Encode(span{
+		Stage: stage.Index,
+		Name:  stage.Name,
+		Seq:   seq,
+		Start: start,
+		End:   end,
+		Nanos: int64(end.Sub(start)),
+	})
+}
+
+// Close flushes and closes the trace file if any
+func (m *Metrics) Close() error {
+	m.mu.Lock()
+	t := m.tracer
+	m.tracer = nil
+	m.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.buf.WriteString("]\n")
+	if err := t.buf.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
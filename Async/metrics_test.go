@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	tracePath := filepath.Join(t.TempDir(), "trace.json")
+	if err := m.TraceTo(tracePath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var collected, deepest int
+	jobs := m.Instrument(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 5; i++ {
+				out <- i
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				time.Sleep(20 * time.Millisecond)
+				out <- val.(int) * 2
+			}
+		}),
+		job(func(in, out chan interface{}) {
+			for range in {
+				collected++
+				// the forwarder holds at most the next item
+				for _, s := range m.Stages() {
+					if depth := s.QueueDepth(); depth > deepest {
+						deepest = depth
+					}
+				}
+			}
+		}),
+	)
+	ExecutePipeline(jobs...)
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if collected != 5 {
+		t.Errorf("collected %d items, expected 5", collected)
+	}
+
+	stages := m.Stages()
+	expected := [][2]uint64{{0, 5}, {5, 5}, {5, 0}}
+	for i, s := range stages {
+		if s.In() != expected[i][0] || s.Out() != expected[i][1] {
+			t.Errorf("[%d] in/out = %d/%d, expected %v", i, s.In(), s.Out(), expected[i])
+		}
+	}
+	for i, s := range stages {
+		if s.QueueDepth() != 0 {
+			t.Errorf("[%d] queue depth = %d after the run, expected 0", i, s.QueueDepth())
+		}
+	}
+	if deepest > 1 {
+		t.Errorf("queue depth %d while running, expected at most 1", deepest)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`pipeline_stage_items_out_total{stage="1",name="TestMetrics.func2"} 5`,
+		`pipeline_stage_latency_seconds_bucket{stage="1",name="TestMetrics.func2",le="0.01"} 0`,
+		`pipeline_stage_latency_seconds_count{stage="1",name="TestMetrics.func2"} 5`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics have no line %q\n%s", line, body)
+		}
+	}
+
+	raw, err := ioutil.ReadFile(tracePath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	spans := []span{}
+	if err := json.Unmarshal(raw, &spans); err != nil {
+		t.Fatalf("trace is not a json array: %v", err)
+	}
+	if len(spans) != 10 {
+		t.Errorf("got %d spans, expected 10", len(spans))
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stageFunc - item level form of a stage: one input, one output or error.
+// Unlike a job it can be timed out and retried item by item
+type stageFunc func(data interface{}) (interface{}, error)
+
+var ErrTimeout = errors.New("item timed out")
+
+// Policy - how a stage handles a failing or hanging item
+type Policy struct {
+	Timeout    time.Duration // per attempt, 0 - wait forever
+	Retries    int           // extra attempts after the first one
+	Backoff    time.Duration // delay before the first retry, doubled for the next ones
+	MaxBackoff time.Duration // 0 - no limit
+}
+
+// Failure - item dropped by a stage after all its attempts
+type Failure struct {
+	Stage    string
+	Item     interface{}
+	Err      error
+	Attempts int
+}
+
+// DeadLetters collects failed items while the rest of the pipeline keeps flowing,
+// every failure is also sent to Sink if it is set and ready to take it;
+// a full or unread Sink never blocks the stage, Failures has them all
+type DeadLetters struct {
+	Sink chan<- Failure
+
+	mu       sync.Mutex
+	failures []Failure
+}
+
+func (d *DeadLetters) Add(f Failure) {
+	d.mu.Lock()
+	d.failures = append(d.failures, f)
+	d.mu.Unlock()
+
+	if d.Sink != nil {
+		select {
+		case d.Sink <- f:
+		default:
+		}
+	}
+}
+
+func (d *DeadLetters) Failures() []Failure {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Failure{}, d.failures...)
+}
+
+// Report writes what was dropped, nothing if all items passed
+func (d *DeadLetters) Report(w io.Writer) {
+	failures := d.Failures()
+	if len(failures) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "dropped %d items:\n", len(failures))
+	for _, f := range failures {
+		fmt.Fprintf(w, "%s %#v after %d attempts: %v\n", f.Stage, f.Item, f.Attempts, f.Err)
+	}
+}
+
+// call runs fn with the timeout and the retries of the policy,
+// a panic in fn counts as a failed attempt
+func (p Policy) call(fn stageFunc, data interface{}) (result interface{}, attempts int, err error) {
+	backoff := p.Backoff
+
+	for attempts = 1; ; attempts++ {
+		result, err = p.attempt(fn, data)
+		if err == nil || attempts > p.Retries {
+			return result, attempts, err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+type attemptResult struct {
+	data interface{}
+	err  error
+}
+
+func (p Policy) attempt(fn stageFunc, data interface{}) (interface{}, error) {
+	// buffered: a timed out attempt must not block forever on send
+	done := make(chan attemptResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- attemptResult{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		res, err := fn(data)
+		done <- attemptResult{res, err}
+	}()
+
+	if p.Timeout <= 0 {
+		res := <-done
+		return res.data, res.err
+	}
+
+	timer := time.NewTimer(p.Timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.data, res.err
+	case <-timer.C:
+		// the hung call is abandoned, its goroutine ends whenever fn returns
+		return nil, ErrTimeout
+	}
+}
+
+// Job - every item is processed concurrently, failed items go to dead
+// and are not sent further
+func (p Policy) Job(stage string, fn stageFunc, dead *DeadLetters) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+
+		for data := range in {
+			wg.Add(1)
+			go func(data interface{}) {
+				defer wg.Done()
+
+				result, attempts, err := p.call(fn, data)
+				if err != nil {
+					if dead != nil {
+						dead.Add(Failure{stage, data, err, attempts})
+					}
+					return
+				}
+				out <- result
+			}(data)
+		}
+
+		wg.Wait()
+	}
+}
+
+// parsePolicy reads "timeout=1s retries=3 backoff=100ms max_backoff=1s"
+func parsePolicy(args []string) (Policy, error) {
+	p := Policy{}
+
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i == -1 {
+			return p, fmt.Errorf("expected key=value, got %q", arg)
+		}
+		key, val := arg[:i], arg[i+1:]
+
+		var err error
+		negative := false
+		switch key {
+		case "timeout":
+			p.Timeout, err = time.ParseDuration(val)
+			negative = p.Timeout < 0
+		case "retries":
+			p.Retries, err = strconv.Atoi(val)
+			negative = p.Retries < 0
+		case "backoff":
+			p.Backoff, err = time.ParseDuration(val)
+			negative = p.Backoff < 0
+		case "max_backoff":
+			p.MaxBackoff, err = time.ParseDuration(val)
+			negative = p.MaxBackoff < 0
+		default:
+			return p, fmt.Errorf("unknown policy option %q", key)
+		}
+		if err == nil && negative {
+			err = fmt.Errorf("must not be negative, got %s", val)
+		}
+		if err != nil {
+			return p, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+
+	return p, nil
+}
+
+var itemStages = map[string]stageFunc{}
+
+// RegisterItem makes an item level stage available for Parse,
+// its arguments are the policy options
+func RegisterItem(name string, fn stageFunc) {
+	itemStages[name] = fn
+	RegisterStage(name, func(p *Pipeline, args []string) (job, error) {
+		policy, err := parsePolicy(args)
+		if err != nil {
+			return nil, err
+		}
+		return policy.Job(name, fn, p.Dead), nil
+	})
+}
+
+func singleHashItem(dataRaw interface{}) (interface{}, error) {
+	dataNum, ok := dataRaw.(int)
+	if !ok {
+		return nil, fmt.Errorf("SingleHash expects int, got %T", dataRaw)
+	}
+	return SignChain.SingleSign(strconv.Itoa(dataNum)), nil
+}
+
+func multiHashItem(dataRaw interface{}) (interface{}, error) {
+	data, ok := dataRaw.(string)
+	if !ok {
+		return nil, fmt.Errorf("MultiHash expects string, got %T", dataRaw)
+	}
+	return SignChain.MultiSign(data), nil
+}
+
+func init() {
+	RegisterItem("SingleHash", singleHashItem)
+	RegisterItem("MultiHash", multiHashItem)
+}
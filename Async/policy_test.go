@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	var calls uint32
+	flaky := func(data interface{}) (interface{}, error) {
+		num := data.(int)
+		switch {
+		case num == 1:
+			// fails twice, then works
+			if atomic.AddUint32(&calls, 1) < 3 {
+				return nil, errors.New("flaky")
+			}
+		case num == 2:
+			time.Sleep(time.Second)
+		case num == 3:
+			panic("boom")
+		}
+		return num * 10, nil
+	}
+
+	dead := &DeadLetters{}
+	policy := Policy{Timeout: 50 * time.Millisecond, Retries: 2, Backoff: time.Millisecond}
+
+	results := []int{}
+	start := time.Now()
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 5; i++ {
+				out <- i
+			}
+		}),
+		policy.Job("flaky", flaky, dead),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				results = append(results, val.(int))
+			}
+		}),
+	)
+
+	if end := time.Since(start); end > 500*time.Millisecond {
+		t.Errorf("hung item blocked the pipeline for %s", end)
+	}
+
+	sort.Ints(results)
+	if len(results) != 3 || results[0] != 0 || results[1] != 10 || results[2] != 40 {
+		t.Errorf("results not match\nGot: %v\nExpected: [0 10 40]", results)
+	}
+
+	failures := dead.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("got %d failures, expected 2: %v", len(failures), failures)
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Item.(int) < failures[j].Item.(int) })
+	if failures[0].Item != 2 || failures[0].Err != ErrTimeout || failures[0].Attempts != 3 {
+		t.Errorf("unexpected failure %+v", failures[0])
+	}
+	if failures[1].Item != 3 || !strings.Contains(failures[1].Err.Error(), "boom") {
+		t.Errorf("unexpected failure %+v", failures[1])
+	}
+
+	report := new(bytes.Buffer)
+	dead.Report(report)
+	if !strings.HasPrefix(report.String(), "dropped 2 items:\n") {
+		t.Errorf("unexpected report\n%s", report)
+	}
+}
+
+func TestDeadLettersSink(t *testing.T) {
+	unread := &DeadLetters{Sink: make(chan Failure)}
+	added := make(chan struct{})
+	go func() {
+		unread.Add(Failure{Stage: "a", Item: 1})
+		unread.Add(Failure{Stage: "a", Item: 2})
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Add blocks on an unread sink")
+	}
+	if failures := unread.Failures(); len(failures) != 2 {
+		t.Errorf("expected 2 failures, got %v", failures)
+	}
+
+	sink := make(chan Failure, 1)
+	buffered := &DeadLetters{Sink: sink}
+	buffered.Add(Failure{Stage: "b", Item: 1})
+	buffered.Add(Failure{Stage: "b", Item: 2})
+	if f := <-sink; f.Item != 1 || len(buffered.Failures()) != 2 {
+		t.Errorf("results not match\nGot: %v %v\nExpected: item 1 in the sink, 2 failures", f, buffered.Failures())
+	}
+}
+
+func TestPolicyDSL(t *testing.T) {
+	p, err := Parse(`SingleHash timeout=3s retries=1 | MultiHash | CombineResults`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	p.Run(ReadLines(strings.NewReader("0\nnot a number\n1\n")), WriteLines(out))
+
+	expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542\n"
+	if out.String() != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", out.String(), expected)
+	}
+	if failures := p.Dead.Failures(); len(failures) != 1 || failures[0].Stage != "SingleHash" {
+		t.Errorf("expected non-number to be dropped by SingleHash, got %v", failures)
+	}
+
+	if _, err := Parse("MultiHash retries=many"); err == nil {
+		t.Errorf("expected error for bad policy")
+	}
+	for _, arg := range []string{"retries=-1", "timeout=-1s", "backoff=-5ms", "max_backoff=-1m"} {
+		field := arg[:strings.Index(arg, "=")]
+		if _, err := Parse("MultiHash " + arg); err == nil || !strings.Contains(err.Error(), field+": must not be negative") {
+			t.Errorf("expected error for %s, got %v", arg, err)
+		}
+	}
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// a worker process is the same binary started with these variables set
+const (
+	workerAddrEnv  = "SIGN_WORKER_ADDR" // network:address of the coordinator
+	workerStageEnv = "SIGN_WORKER_STAGE"
+	workerTokenEnv = "SIGN_WORKER_TOKEN"
+	workerChainEnv = "SIGN_WORKER_CHAIN" // SignChain of the coordinator as JSON
+)
+
+const (
+	frameHello  = "hello"
+	frameItem   = "item"
+	frameResult = "result"
+	frameError  = "error"
+	frameClose  = "close"
+
+	maxFrameSize = 64 << 20
+	helloTimeout = 10 * time.Second
+)
+
+var ErrWorkerLost = errors.New("worker crashed too many times")
+
+// DefaultListen - where the coordinator of "remote" stages listens,
+// "unix:/path/to.sock" or "tcp:host:port"
+var DefaultListen = "tcp:127.0.0.1:0"
+
+// frame - message between the coordinator and a worker,
+// sent as a big-endian uint32 length and a JSON body
+type frame struct {
+	Kind  string          `json:"kind"`
+	ID    uint64          `json:"id,omitempty"`
+	Token string          `json:"token,omitempty"`
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	body, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	copy(buf[4:], body)
+	_, err = w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	f := frame{}
+
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return f, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return f, fmt.Errorf("frame of %d bytes is too big", n)
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return f, err
+	}
+	return f, json.Unmarshal(body, &f)
+}
+
+// setValue - pipeline values crossing processes are int or string
+func (f *frame) setValue(v interface{}) (err error) {
+	switch v.(type) {
+	case int:
+		f.Type = "int"
+	case string:
+		f.Type = "string"
+	default:
+		return fmt.Errorf("remote stages pass int and string only, got %T", v)
+	}
+	f.Value, err = json.Marshal(v)
+	return err
+}
+
+func (f frame) value() (interface{}, error) {
+	switch f.Type {
+	case "int":
+		var v int
+		err := json.Unmarshal(f.Value, &v)
+		return v, err
+	case "string":
+		var v string
+		err := json.Unmarshal(f.Value, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unknown value type %q", f.Type)
+}
+
+// Coordinator starts worker processes for item stages and feeds them
+// over a local socket. Items of a crashed worker are sent again to its
+// restarted copy or to the other workers of the stage
+type Coordinator struct {
+	// Restarts - how many times a worker is restarted before its items are dropped
+	Restarts int
+	// Command - worker process, os.Args[0] by default;
+	// the connection settings are added to its environment
+	Command func() *exec.Cmd
+
+	listener  net.Listener
+	mu        sync.Mutex
+	waiting   map[string]chan net.Conn
+	tokens    uint64
+	restarted uint64
+}
+
+func NewCoordinator(network, addr string) (*Coordinator, error) {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Coordinator{
+		Restarts: 3,
+		listener: listener,
+		waiting:  map[string]chan net.Conn{},
+	}
+	go c.accept()
+	return c, nil
+}
+
+// Listen - NewCoordinator for "network:address"
+func Listen(addr string) (*Coordinator, error) {
+	i := strings.Index(addr, ":")
+	if i == -1 {
+		return nil, fmt.Errorf("expected network:address, got %q", addr)
+	}
+	return NewCoordinator(addr[:i], addr[i+1:])
+}
+
+// Addr - network:address for the workers
+func (c *Coordinator) Addr() string {
+	addr := c.listener.Addr()
+	return addr.Network() + ":" + addr.String()
+}
+
+// Restarted - how many times workers were restarted after a crash
+func (c *Coordinator) Restarted() uint64 {
+	return atomic.LoadUint64(&c.restarted)
+}
+
+func (c *Coordinator) Close() error {
+	return c.listener.Close()
+}
+
+func (c *Coordinator) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			conn.SetReadDeadline(time.Now().Add(helloTimeout))
+			hello, err := readFrame(conn)
+			conn.SetReadDeadline(time.Time{})
+
+			c.mu.Lock()
+			waiter, ok := c.waiting[hello.Token]
+			delete(c.waiting, hello.Token)
+			c.mu.Unlock()
+
+			if err != nil || hello.Kind != frameHello || !ok {
+				conn.Close()
+				return
+			}
+			waiter <- conn
+		}()
+	}
+}
+
+type workerProc struct {
+	cmd    *exec.Cmd
+	conn   net.Conn
+	exited chan error
+}
+
+func (c *Coordinator) spawn(stage string) (*workerProc, error) {
+	token := strconv.FormatUint(atomic.AddUint64(&c.tokens, 1), 10)
+	waiter := make(chan net.Conn, 1)
+
+	c.mu.Lock()
+	c.waiting[token] = waiter
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.waiting, token)
+		c.mu.Unlock()
+	}()
+
+	var cmd *exec.Cmd
+	if c.Command != nil {
+		cmd = c.Command()
+	} else {
+		cmd = exec.Command(os.Args[0])
+		// stdout of the coordinator is the pipeline output
+		cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	}
+	chain, err := json.Marshal(SignChain)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = append(os.Environ(),
+		workerAddrEnv+"="+c.Addr(),
+		workerStageEnv+"="+stage,
+		workerTokenEnv+"="+token,
+		workerChainEnv+"="+string(chain),
+	)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case conn := <-waiter:
+		return &workerProc{cmd, conn, exited}, nil
+	case err := <-exited:
+		return nil, fmt.Errorf("worker exited before connecting: %v", err)
+	case <-time.After(helloTimeout):
+		cmd.Process.Kill()
+		<-exited
+		return nil, fmt.Errorf("worker did not connect in %s", helloTimeout)
+	}
+}
+
+type remoteTask struct {
+	id   uint64
+	data interface{}
+}
+
+// taskQueue - items of a remote stage shared by its workers
+type taskQueue struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	tasks       []remoteTask
+	outstanding int // pushed and not answered yet
+	closed      bool
+	live        int // workers still able to take tasks
+}
+
+func newTaskQueue(workers int) *taskQueue {
+	q := &taskQueue{live: workers}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push - false if no worker is left to process the task
+func (q *taskQueue) push(t remoteTask) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.live == 0 {
+		return false
+	}
+	q.tasks = append(q.tasks, t)
+	q.outstanding++
+	q.cond.Signal()
+	return true
+}
+
+func (q *taskQueue) retry(tasks ...remoteTask) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, tasks...)
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+func (q *taskQueue) done() {
+	q.mu.Lock()
+	q.outstanding--
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// next blocks until there is a task, false when all of them are answered
+func (q *taskQueue) next() (remoteTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.tasks) == 0 && !(q.closed && q.outstanding == 0) {
+		q.cond.Wait()
+	}
+	if len(q.tasks) == 0 {
+		return remoteTask{}, false
+	}
+	t := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return t, true
+}
+
+// abandon - a worker gave up, the last one takes the tasks left to drop them
+func (q *taskQueue) abandon() []remoteTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.live--
+	if q.live > 0 {
+		return nil
+	}
+	left := q.tasks
+	q.tasks = nil
+	q.outstanding -= len(left)
+	q.cond.Broadcast()
+	return left
+}
+
+// RemoteJob - item stage executed by workers processes
+func (c *Coordinator) RemoteJob(stage string, workers int, dead *DeadLetters) (job, error) {
+	if _, ok := itemStages[stage]; !ok {
+		return nil, fmt.Errorf("%q is not an item stage", stage)
+	}
+	if workers <= 0 {
+		return nil, fmt.Errorf("workers must be positive, got %d", workers)
+	}
+	if dead == nil {
+		dead = &DeadLetters{}
+	}
+
+	return func(in, out chan interface{}) {
+		q := newTaskQueue(workers)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.runWorker(stage, q, out, dead)
+			}()
+		}
+
+		var id uint64
+		for data := range in {
+			id++
+			if !q.push(remoteTask{id, data}) {
+				dead.Add(Failure{stage, data, ErrWorkerLost, 0})
+			}
+		}
+		q.close()
+		wg.Wait()
+	}, nil
+}
+
+func (c *Coordinator) runWorker(stage string, q *taskQueue, out chan interface{}, dead *DeadLetters) {
+	for restarts := 0; ; restarts++ {
+		if restarts > 0 {
+			atomic.AddUint64(&c.restarted, 1)
+		}
+
+		w, err := c.spawn(stage)
+		if err == nil && w.serve(stage, q, out, dead) {
+			return
+		}
+		if err != nil {
+			log.Printf("%s worker: %v", stage, err)
+		}
+
+		if restarts >= c.Restarts {
+			for _, t := range q.abandon() {
+				dead.Add(Failure{stage, t.data, ErrWorkerLost, restarts + 1})
+			}
+			return
+		}
+	}
+}
+
+// serve feeds the worker until all tasks are answered (true)
+// or the worker is lost (false), its unanswered tasks are retried
+func (w *workerProc) serve(stage string, q *taskQueue, out chan interface{}, dead *DeadLetters) bool {
+	mu := &sync.Mutex{}
+	inflight := map[uint64]remoteTask{}
+	// closing - close was sent, the worker ends the connection itself
+	lost, closing := false, false
+	readerDone := make(chan struct{})
+
+	go func() {
+		defer close(readerDone)
+		for {
+			f, err := readFrame(w.conn)
+			if err != nil {
+				mu.Lock()
+				lost = !closing
+				tasks := make([]remoteTask, 0, len(inflight))
+				for _, t := range inflight {
+					tasks = append(tasks, t)
+				}
+				inflight = map[uint64]remoteTask{}
+				mu.Unlock()
+
+				q.retry(tasks...)
+				w.conn.Close()
+				return
+			}
+
+			mu.Lock()
+			t, ok := inflight[f.ID]
+			delete(inflight, f.ID)
+			mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			result, err := f.value()
+			if f.Kind == frameError {
+				err = errors.New(f.Error)
+			}
+			if err != nil {
+				dead.Add(Failure{stage, t.data, err, 1})
+			} else {
+				out <- result
+			}
+			q.done()
+		}
+	}()
+
+	for {
+		t, ok := q.next()
+		if !ok {
+			break
+		}
+
+		f := frame{Kind: frameItem, ID: t.id}
+		if err := f.setValue(t.data); err != nil {
+			dead.Add(Failure{stage, t.data, err, 0})
+			q.done()
+			continue
+		}
+
+		mu.Lock()
+		if lost {
+			mu.Unlock()
+			q.retry(t)
+			return w.stop()
+		}
+		inflight[t.id] = t
+		mu.Unlock()
+
+		// on error the reader notices the closed connection and retries the task
+		if err := writeFrame(w.conn, f); err != nil {
+			w.conn.Close()
+			<-readerDone
+			return w.stop()
+		}
+	}
+
+	mu.Lock()
+	closing = true
+	mu.Unlock()
+	writeFrame(w.conn, frame{Kind: frameClose})
+	<-readerDone
+
+	// crashed while the other workers answered its retried tasks
+	mu.Lock()
+	crashed := lost
+	mu.Unlock()
+	if crashed {
+		return w.stop()
+	}
+	<-w.exited
+	return true
+}
+
+// stop kills the lost worker, always false for serve
+func (w *workerProc) stop() bool {
+	w.conn.Close()
+	w.cmd.Process.Kill()
+	<-w.exited
+	return false
+}
+
+// IsWorker - the process was started by a Coordinator
+func IsWorker() bool {
+	return os.Getenv(workerAddrEnv) != ""
+}
+
+// RunWorker - worker process side: applies the item stage named in the
+// environment to every item from the coordinator until it says close,
+// with the SignChain of the coordinator
+func RunWorker() error {
+	addr, stage := os.Getenv(workerAddrEnv), os.Getenv(workerStageEnv)
+	fn, ok := itemStages[stage]
+	if !ok {
+		return fmt.Errorf("%q is not an item stage", stage)
+	}
+	if raw := os.Getenv(workerChainEnv); raw != "" {
+		c := Chain{}
+		if err := json.Unmarshal([]byte(raw), &c); err != nil {
+			return fmt.Errorf("%s: %v", workerChainEnv, err)
+		}
+		chain, err := NewChain(c.Single, c.Multi, c.Threads)
+		if err != nil {
+			return err
+		}
+		SignChain = chain
+	}
+
+	i := strings.Index(addr, ":")
+	if i == -1 {
+		return fmt.Errorf("expected network:address, got %q", addr)
+	}
+	conn, err := net.Dial(addr[:i], addr[i+1:])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := writeFrame(conn, frame{Kind: frameHello, Token: os.Getenv(workerTokenEnv)}); err != nil {
+		return err
+	}
+
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return err
+		}
+		if f.Kind == frameClose {
+			wg.Wait()
+			return nil
+		}
+
+		wg.Add(1)
+		go func(f frame) {
+			defer wg.Done()
+
+			reply := frame{Kind: frameResult, ID: f.ID}
+			data, err := f.value()
+			if err == nil {
+				var result interface{}
+				if result, err = fn(data); err == nil {
+					err = reply.setValue(result)
+				}
+			}
+			if err != nil {
+				reply = frame{Kind: frameError, ID: f.ID, Error: err.Error()}
+			}
+
+			mu.Lock()
+			writeFrame(conn, reply)
+			mu.Unlock()
+		}(f)
+	}
+}
+
+func init() {
+	// remote STAGE [WORKERS] - item stage in worker processes
+	RegisterStage("remote", func(p *Pipeline, args []string) (job, error) {
+		if len(args) == 0 || len(args) > 2 {
+			return nil, fmt.Errorf("needs an item stage and an optional workers count")
+		}
+		if _, ok := itemStages[args[0]]; !ok {
+			return nil, fmt.Errorf("%q is not an item stage", args[0])
+		}
+		workers := 1
+		if len(args) == 2 {
+			var err error
+			if workers, err = positiveArg(args[1:]); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.Remote == nil {
+			var err error
+			if p.Remote, err = Listen(DefaultListen); err != nil {
+				return nil, err
+			}
+		}
+		return p.Remote.RemoteJob(args[0], workers, p.Dead)
+	})
+}
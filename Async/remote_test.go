@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// worker processes are this test binary started by the coordinator
+func TestMain(m *testing.M) {
+	if IsWorker() {
+		if err := RunWorker(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+const crashMarkEnv = "SIGN_TEST_CRASH_MARK"
+
+func init() {
+	// crashes the worker on the first item seen by any of its copies
+	RegisterItem("crashOnce", func(data interface{}) (interface{}, error) {
+		// only the copy that creates the mark crashes
+		if file, err := os.OpenFile(os.Getenv(crashMarkEnv), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); err == nil {
+			file.Close()
+			os.Exit(3)
+		}
+		return fmt.Sprintf("%v!", data), nil
+	})
+	RegisterItem("failOdd", func(data interface{}) (interface{}, error) {
+		if data.(int)%2 != 0 {
+			return nil, fmt.Errorf("odd")
+		}
+		return data, nil
+	})
+}
+
+func TestRemoteSigner(t *testing.T) {
+	defer func(listen string) { DefaultListen = listen }(DefaultListen)
+
+	for _, listen := range []string{
+		"tcp:127.0.0.1:0",
+		"unix:" + filepath.Join(t.TempDir(), "sign.sock"),
+	} {
+		DefaultListen = listen
+		p, err := Parse("remote SingleHash 2 | remote MultiHash 3 | CombineResults")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		out := new(bytes.Buffer)
+		p.Run(ReadLines(strings.NewReader("0\n1\n")), WriteLines(out))
+		p.Remote.Close()
+
+		expected := "29568666068035183841425683795340791879727309630931025356555_4958044192186797981418233587017209679042592862002427381542\n"
+		if out.String() != expected {
+			t.Errorf("%s: results not match\nGot: %v\nExpected: %v", listen, out.String(), expected)
+		}
+	}
+}
+
+func TestRemoteChain(t *testing.T) {
+	defer func(chain *Chain) { SignChain = chain }(SignChain)
+	chain, err := NewChain("crc32c(data)~xxhash(md5(data))", "xxhash(th+data)", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(spec string) string {
+		p, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out := new(bytes.Buffer)
+		p.Run(ReadLines(strings.NewReader("0\n1\n2\n")), WriteLines(out))
+		if p.Remote != nil {
+			p.Remote.Close()
+		}
+		return out.String()
+	}
+
+	def := run("SingleHash | MultiHash | CombineResults")
+	SignChain = chain
+	expected := run("SingleHash | MultiHash | CombineResults")
+	if expected == def {
+		t.Fatalf("the chain gives the default results")
+	}
+	if got := run("remote SingleHash 2 | remote MultiHash 2 | CombineResults"); got != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, expected)
+	}
+}
+
+func TestRemoteCrash(t *testing.T) {
+	os.Setenv(crashMarkEnv, filepath.Join(t.TempDir(), "crashed"))
+	defer os.Unsetenv(crashMarkEnv)
+
+	p, err := Parse("remote crashOnce 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Remote.Close()
+
+	out := new(bytes.Buffer)
+	p.Run(ReadLines(strings.NewReader("0\n1\n2\n3\n4\n")), WriteLines(out))
+
+	results := strings.Fields(out.String())
+	sort.Strings(results)
+	if strings.Join(results, " ") != "0! 1! 2! 3! 4!" {
+		t.Errorf("results not match\nGot: %v\nExpected: [0! 1! 2! 3! 4!]", results)
+	}
+	if p.Remote.Restarted() != 1 {
+		t.Errorf("got %d restarts, expected 1", p.Remote.Restarted())
+	}
+	if failures := p.Dead.Failures(); len(failures) != 0 {
+		t.Errorf("unexpected failures %v", failures)
+	}
+}
+
+func TestRemoteErrors(t *testing.T) {
+	p, err := Parse("remote failOdd 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer p.Remote.Close()
+
+	out := new(bytes.Buffer)
+	p.Run(ReadLines(strings.NewReader("1\n2\n3\n")), WriteLines(out))
+
+	if out.String() != "2\n" {
+		t.Errorf("results not match\nGot: %v\nExpected: 2", out.String())
+	}
+	if failures := p.Dead.Failures(); len(failures) != 2 {
+		t.Errorf("expected 2 failures, got %v", failures)
+	}
+
+	for idx, spec := range []string{"remote", "remote CombineResults", "remote failOdd 0"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("[%d] expected error for %q", idx, spec)
+		}
+	}
+}
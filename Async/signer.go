@@ -7,7 +7,7 @@ import (
 	"sync"
 )
 
-// SingleHash - crc32(data) + "~" + crc32(md5(data)
+// SingleHash - SignChain.Single, crc32(data) + "~" + crc32(md5(data) by default
 func SingleHash(in, out chan interface{}) {
 	wg := &sync.WaitGroup{}
 
@@ -16,24 +16,16 @@ func SingleHash(in, out chan interface{}) {
 		data := strconv.Itoa(dataNum)
 
 		wg.Add(1)
-		md5 := DataSignerMd5(data)
-		crc32Ch := make(chan string, 1)
 		go func(data string) {
 			defer wg.Done()
-
-			go func(ch chan string) {
-				ch <- DataSignerCrc32(data)
-			}(crc32Ch)
-			crc32fromMd5 := DataSignerCrc32(md5)
-
-			out <- (<-crc32Ch) + "~" + crc32fromMd5
+			out <- SignChain.SingleSign(data)
 		}(data)
 	}
 
 	wg.Wait()
 }
 
-// MultiHash - crc32(th + data), th = 0..5, concat
+// MultiHash - SignChain.Multi, crc32(th + data), th = 0..5, concat by default
 func MultiHash(in, out chan interface{}) {
 	wg := &sync.WaitGroup{}
 
@@ -43,21 +35,7 @@ func MultiHash(in, out chan interface{}) {
 		wg.Add(1)
 		go func(data string) {
 			defer wg.Done()
-			channels := make([]chan string, 6)
-			for th := 0; th < 6; th++ {
-				channels[th] = make(chan string, 1)
-
-				go func(ch chan string, input string) {
-					ch <- DataSignerCrc32(input)
-				}(channels[th], strconv.Itoa(th)+data)
-			}
-
-			var result string
-			for _, ch := range channels {
-				result += <-ch
-			}
-
-			out <- result
+			out <- SignChain.MultiSign(data)
 		}(data)
 	}
 
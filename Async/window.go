@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reducer turns the items of a window into the value sent further
+type reducer func(items []interface{}) interface{}
+
+// combineItems - CombineResults of a window: join(sort(items), "_")
+func combineItems(items []interface{}) interface{} {
+	results := make([]string, len(items))
+	for i, item := range items {
+		results[i] = fmt.Sprint(item)
+	}
+	sort.Strings(results)
+	return strings.Join(results, "_")
+}
+
+func sliceItems(items []interface{}) interface{} {
+	return append([]interface{}{}, items...)
+}
+
+// CountWindow - the last size items, sent every step items once size are seen.
+// step == size gives tumbling windows, the last (shorter) one is sent on close
+func CountWindow(size, step int, reduce reducer) job {
+	return func(in, out chan interface{}) {
+		window := make([]interface{}, 0, size)
+		seen := 0
+
+		for data := range in {
+			if len(window) == size {
+				window = append(window[:0], window[1:]...)
+			}
+			window = append(window, data)
+			seen++
+
+			if seen >= size && (seen-size)%step == 0 {
+				out <- reduce(window)
+			}
+		}
+
+		if step != size {
+			return
+		}
+		rest := seen % size
+		if seen < size {
+			rest = seen
+		}
+		if rest > 0 {
+			out <- reduce(window[len(window)-rest:])
+		}
+	}
+}
+
+type timedItem struct {
+	at   time.Time
+	data interface{}
+}
+
+// TimeWindow - items received during the last size, sent every step
+// if there is anything new. step == size gives tumbling windows.
+// Items received since the last tick are sent on close
+func TimeWindow(size, step time.Duration, reduce reducer) job {
+	return func(in, out chan interface{}) {
+		ticker := time.NewTicker(step)
+		defer ticker.Stop()
+
+		window := []timedItem{}
+		fresh := false
+
+		flush := func(now time.Time) {
+			drop := 0
+			for drop < len(window) && now.Sub(window[drop].at) >= size {
+				drop++
+			}
+			window = window[drop:]
+
+			if !fresh || len(window) == 0 {
+				return
+			}
+			items := make([]interface{}, len(window))
+			for i, item := range window {
+				items[i] = item.data
+			}
+			out <- reduce(items)
+			fresh = false
+		}
+
+		for {
+			select {
+			case data, ok := <-in:
+				if !ok {
+					flush(time.Now())
+					return
+				}
+				window = append(window, timedItem{time.Now(), data})
+				fresh = true
+			case now := <-ticker.C:
+				flush(now)
+			}
+		}
+	}
+}
+
+// topHeap - max-heap, the root is the first value to drop
+type topHeap []string
+
+func (h topHeap) Len() int            { return len(h) }
+func (h topHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h topHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// TopK - the k first results in CombineResults order, sent every
+// time they change, so memory is bounded by k
+func TopK(k int) job {
+	return func(in, out chan interface{}) {
+		top := &topHeap{}
+
+		for dataRaw := range in {
+			data := fmt.Sprint(dataRaw)
+			if top.Len() == k {
+				if data >= (*top)[0] {
+					continue
+				}
+				heap.Pop(top)
+			}
+			heap.Push(top, data)
+
+			sorted := append([]string{}, (*top)...)
+			sort.Strings(sorted)
+			out <- strings.Join(sorted, "_")
+		}
+	}
+}
+
+// ExternalSortFanIn - runs merged at once, so a sort keeps at most that many
+// files open; more runs are merged into bigger ones first
+var ExternalSortFanIn = 64
+
+// ExternalSort - sends all items sorted as strings, keeping at most
+// limit of them in memory: sorted runs are spilled to temp files in dir
+// ("" - os.TempDir) and merged on close. Items of runs that can't be
+// written or read go to dead (logged if it's nil) and are not sent further
+func ExternalSort(limit int, dir string, dead *DeadLetters) job {
+	fail := func(item interface{}, err error) {
+		if dead == nil {
+			log.Printf("extsort: %v", err)
+			return
+		}
+		dead.Add(Failure{"extsort", item, err, 1})
+	}
+
+	return func(in, out chan interface{}) {
+		runs := []string{}
+		defer func() {
+			for _, run := range runs {
+				os.Remove(run)
+			}
+		}()
+
+		chunk := make([]string, 0, limit)
+		for data := range in {
+			chunk = append(chunk, fmt.Sprint(data))
+			if len(chunk) < limit {
+				continue
+			}
+			if run, err := spillRun(chunk, dir); err != nil {
+				fail(append([]string{}, chunk...), err)
+			} else {
+				runs = append(runs, run)
+			}
+			chunk = chunk[:0]
+		}
+		sort.Strings(chunk)
+
+		for len(runs) > ExternalSortFanIn {
+			group := runs[:ExternalSortFanIn]
+			run, err := mergeToRun(group, dir, fail)
+			for _, name := range group {
+				os.Remove(name)
+			}
+			runs = runs[len(group):]
+			if err != nil {
+				fail(group, err)
+				continue
+			}
+			runs = append(runs, run)
+		}
+
+		mergeRuns(runs, chunk, func(item string) error {
+			out <- item
+			return nil
+		}, fail)
+	}
+}
+
+// spillRun writes the sorted chunk to a temp file, a quoted item per line
+func spillRun(chunk []string, dir string) (string, error) {
+	sort.Strings(chunk)
+	return writeRun(dir, func(w *bufio.Writer) error {
+		for _, item := range chunk {
+			writeRunItem(w, item)
+		}
+		return nil
+	})
+}
+
+// mergeToRun - the runs merged into a new one
+func mergeToRun(runs []string, dir string, fail func(interface{}, error)) (string, error) {
+	return writeRun(dir, func(w *bufio.Writer) error {
+		return mergeRuns(runs, nil, func(item string) error {
+			return writeRunItem(w, item)
+		}, fail)
+	})
+}
+
+// writeRun - a temp file with what write puts there, removed on errors
+func writeRun(dir string, write func(w *bufio.Writer) error) (string, error) {
+	file, err := ioutil.TempFile(dir, "extsort-")
+	if err != nil {
+		return "", err
+	}
+
+	buf := bufio.NewWriter(file)
+	err = write(buf)
+	if err == nil {
+		err = buf.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+func writeRunItem(w *bufio.Writer, item string) error {
+	w.WriteString(strconv.Quote(item))
+	return w.WriteByte('\n')
+}
+
+type runCursor struct {
+	name    string
+	head    string
+	scanner *bufio.Scanner // nil for the in-memory chunk
+	rest    []string
+}
+
+func (c *runCursor) next() (bool, error) {
+	if c.scanner == nil {
+		if len(c.rest) == 0 {
+			return false, nil
+		}
+		c.head, c.rest = c.rest[0], c.rest[1:]
+		return true, nil
+	}
+
+	if !c.scanner.Scan() {
+		return false, c.scanner.Err()
+	}
+	var err error
+	c.head, err = strconv.Unquote(c.scanner.Text())
+	return err == nil, err
+}
+
+type runHeap []*runCursor
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].head < h[j].head }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runCursor)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// mergeRuns - k-way merge of the spilled runs and the last in-memory chunk
+// into emit; a run that can't be read goes to fail with the rest of it
+// dropped, an error of emit stops the merge
+func mergeRuns(runs []string, chunk []string, emit func(item string) error, fail func(interface{}, error)) error {
+	cursors := &runHeap{}
+
+	for _, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			fail(run, err)
+			continue
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<30)
+		cursor := &runCursor{name: run, scanner: scanner}
+		if ok, err := cursor.next(); err != nil {
+			fail(run, err)
+		} else if ok {
+			*cursors = append(*cursors, cursor)
+		}
+	}
+	if len(chunk) > 0 {
+		*cursors = append(*cursors, &runCursor{head: chunk[0], rest: chunk[1:]})
+	}
+	heap.Init(cursors)
+
+	for cursors.Len() > 0 {
+		cursor := (*cursors)[0]
+		if err := emit(cursor.head); err != nil {
+			return err
+		}
+
+		ok, err := cursor.next()
+		if err != nil {
+			fail(cursor.name, err)
+		}
+		if ok {
+			heap.Fix(cursors, 0)
+		} else {
+			heap.Pop(cursors)
+		}
+	}
+
+	return nil
+}
+
+// Join - all items joined by sep, sent on close
+func Join(sep string) job {
+	return func(in, out chan interface{}) {
+		results := []string{}
+		for data := range in {
+			results = append(results, fmt.Sprint(data))
+		}
+		out <- strings.Join(results, sep)
+	}
+}
+
+// windowArgs reads "N [STEP]" or "DURATION [STEP]", step defaults to size
+func windowArgs(args []string) (count, countStep int, dur, durStep time.Duration, err error) {
+	if len(args) == 0 || len(args) > 2 {
+		return 0, 0, 0, 0, fmt.Errorf("needs a size and an optional step")
+	}
+
+	if count, err = strconv.Atoi(args[0]); err == nil {
+		countStep = count
+		if len(args) == 2 {
+			if countStep, err = strconv.Atoi(args[1]); err != nil {
+				return 0, 0, 0, 0, fmt.Errorf("step of a count window must be int, got %q", args[1])
+			}
+		}
+		if count <= 0 || countStep <= 0 || countStep > count {
+			return 0, 0, 0, 0, fmt.Errorf("expected 0 < step <= size, got %d %d", count, countStep)
+		}
+		return count, countStep, 0, 0, nil
+	}
+
+	if dur, err = time.ParseDuration(args[0]); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("size must be int or duration, got %q", args[0])
+	}
+	durStep = dur
+	if len(args) == 2 {
+		if durStep, err = time.ParseDuration(args[1]); err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("step of a time window must be duration, got %q", args[1])
+		}
+	}
+	if dur <= 0 || durStep <= 0 || durStep > dur {
+		return 0, 0, 0, 0, fmt.Errorf("expected 0 < step <= size, got %s %s", dur, durStep)
+	}
+	return 0, 0, dur, durStep, nil
+}
+
+func windowStage(tumbling bool, reduce reducer) stageFactory {
+	return func(p *Pipeline, args []string) (job, error) {
+		if tumbling && len(args) != 1 {
+			return nil, fmt.Errorf("needs a size (count or duration)")
+		}
+		count, countStep, dur, durStep, err := windowArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return CountWindow(count, countStep, reduce), nil
+		}
+		return TimeWindow(dur, durStep, reduce), nil
+	}
+}
+
+func init() {
+	RegisterStage("tumble", windowStage(true, combineItems))
+	RegisterStage("slide", windowStage(false, combineItems))
+
+	RegisterStage("topk", func(p *Pipeline, args []string) (job, error) {
+		k, err := positiveArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return TopK(k), nil
+	})
+
+	RegisterStage("extsort", func(p *Pipeline, args []string) (job, error) {
+		dir := ""
+		if len(args) == 2 {
+			args, dir = args[:1], args[1]
+		}
+		limit, err := positiveArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return ExternalSort(limit, dir, p.Dead), nil
+	})
+
+	RegisterStage("join", func(p *Pipeline, args []string) (job, error) {
+		switch len(args) {
+		case 0:
+			return Join("_"), nil
+		case 1:
+			return Join(args[0]), nil
+		}
+		return nil, fmt.Errorf("takes an optional separator")
+	})
+}
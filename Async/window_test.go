@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWindowStages(t *testing.T) {
+	cases := []struct {
+		spec, input, expected string
+	}{
+		{"tumble 2", "b\na\nd\nc\ne\n", "a_b\nc_d\ne\n"},
+		{"slide 3 2", "5\n4\n3\n2\n1\n", "3_4_5\n1_2_3\n"},
+		{"topk 2", "5\n3\n4\n1\n2\n", "5\n3_5\n3_4\n1_3\n1_2\n"},
+		{"extsort 2 | join", "b\ne\na\nd\nc\n", "a_b_c_d_e\n"},
+		{"extsort 100 | join -", "b\na\n", "a-b\n"},
+	}
+
+	for idx, item := range cases {
+		p, err := Parse(item.spec)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		out := new(bytes.Buffer)
+		p.Run(ReadLines(strings.NewReader(item.input)), WriteLines(out))
+		if out.String() != item.expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), item.expected)
+		}
+	}
+
+	for idx, spec := range []string{"tumble", "tumble 2 1", "slide 2 3", "slide 1s 2s", "slide x", "topk 0", "extsort"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("[%d] expected error for %q", idx, spec)
+		}
+	}
+}
+
+func TestExternalSort(t *testing.T) {
+	defer func(fanIn int) { ExternalSortFanIn = fanIn }(ExternalSortFanIn)
+	ExternalSortFanIn = 2
+
+	dir := t.TempDir()
+	p, err := Parse("extsort 1 " + dir + " | join")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := new(bytes.Buffer)
+	p.Run(ReadLines(strings.NewReader("i\nc\ng\na\nf\nh\nb\ne\nd\n")), WriteLines(out))
+	if out.String() != "a_b_c_d_e_f_g_h_i\n" {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\na_b_c_d_e_f_g_h_i", out.String())
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Errorf("runs are left: %v", left)
+	}
+
+	// runs can't be written: their items are dropped, the rest is sorted
+	p, err = Parse("extsort 2 " + filepath.Join(dir, "missing") + " | join")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out.Reset()
+	p.Run(ReadLines(strings.NewReader("b\ne\na\nd\nc\n")), WriteLines(out))
+	if out.String() != "c\n" {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\nc", out.String())
+	}
+	failures := p.Dead.Failures()
+	if len(failures) != 2 || !reflect.DeepEqual(failures[0].Item, []string{"b", "e"}) {
+		t.Errorf("expected 2 failures of the runs, got %v", failures)
+	}
+}
+
+// like TestPipeline: a time window must emit results
+// without waiting for the end of an infinite input
+func TestTimeWindowFreeFlow(t *testing.T) {
+	var windows uint32
+	var stop uint32
+
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for i := 0; atomic.LoadUint32(&stop) == 0; i++ {
+				out <- i
+				time.Sleep(5 * time.Millisecond)
+			}
+		}),
+		TimeWindow(30*time.Millisecond, 30*time.Millisecond, combineItems),
+		job(func(in, out chan interface{}) {
+			for range in {
+				if atomic.AddUint32(&windows, 1) == 3 {
+					atomic.StoreUint32(&stop, 1)
+				}
+			}
+		}),
+	)
+
+	if atomic.LoadUint32(&windows) < 3 {
+		t.Errorf("got %d windows, expected at least 3", windows)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GoTest - runs go test with the arguments in the current directory, the
+// benchmarks are the Benchmark functions of the tests of the package
+var GoTest = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("go", append([]string{"test"}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("go test: %v\n%s%s", err, out, exit.Stderr)
+		}
+		return nil, fmt.Errorf("go test: %v", err)
+	}
+	return out, nil
+}
+
+// BenchResult - the samples of one benchmark, one per run
+type BenchResult struct {
+	Name        string    `json:"name"`
+	NsPerOp     []float64 `json:"ns_per_op"`
+	BytesPerOp  []float64 `json:"bytes_per_op"`
+	AllocsPerOp []float64 `json:"allocs_per_op"`
+}
+
+// BenchRun - results of all benchmarks run at once
+type BenchRun struct {
+	Label   string        `json:"label"`
+	Time    time.Time     `json:"time"`
+	Go      string        `json:"go"`
+	CPUs    int           `json:"cpus"`
+	Results []BenchResult `json:"results"`
+}
+
+// BenchHistory - runs in the order they were saved
+type BenchHistory struct {
+	Runs []BenchRun `json:"runs"`
+}
+
+// RunBenchmarks - the benchmarks with names matching the pattern, each of
+// them count times; benchtime is passed to go test if it's not empty.
+// Names are without Benchmark: BenchmarkFast is Fast
+func RunBenchmarks(pattern *regexp.Regexp, count int, benchtime string) (BenchRun, error) {
+	run := BenchRun{Time: time.Now().UTC(), Go: runtime.Version(), CPUs: runtime.NumCPU()}
+	names, err := benchNames(pattern)
+	if err != nil || len(names) == 0 {
+		return run, err
+	}
+
+	args := []string{"-run", "^$", "-bench", benchPattern(names...), "-benchmem", "-count", strconv.Itoa(count), "-json"}
+	if benchtime != "" {
+		args = append(args, "-benchtime", benchtime)
+	}
+	out, err := GoTest(args...)
+	if err != nil {
+		return run, err
+	}
+	results, err := parseBenchOutput(out)
+	if err != nil {
+		return run, err
+	}
+	for _, name := range names {
+		if result, ok := results[name]; ok {
+			run.Results = append(run.Results, *result)
+		}
+	}
+	return run, nil
+}
+
+// benchNames - the sorted names of the benchmarks go test knows of that
+// match the pattern
+func benchNames(pattern *regexp.Regexp) ([]string, error) {
+	out, err := GoTest("-list", "^Benchmark")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "Benchmark") {
+			continue
+		}
+		if name := strings.TrimPrefix(line, "Benchmark"); pattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// benchPattern - the -bench of go test for exactly these benchmarks
+func benchPattern(names ...string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return "^Benchmark(" + strings.Join(quoted, "|") + ")$"
+}
+
+// parseBenchOutput - the results from go test -json, a sample per line like
+//
+//	BenchmarkFast-8   100   2782432 ns/op   559910 B/op   10422 allocs/op
+func parseBenchOutput(data []byte) (map[string]*BenchResult, error) {
+	text := []byte{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var event struct{ Output string }
+		if err := decoder.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("go test output: %v", err)
+		}
+		text = append(text, event.Output...)
+	}
+
+	results := map[string]*BenchResult{}
+	for _, line := range strings.Split(string(text), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := strings.TrimPrefix(fields[0], "Benchmark")
+		// the GOMAXPROCS suffix
+		if dash := strings.LastIndexByte(name, '-'); dash != -1 {
+			if _, err := strconv.Atoi(name[dash+1:]); err == nil {
+				name = name[:dash]
+			}
+		}
+		result := results[name]
+		if result == nil {
+			result = &BenchResult{Name: name}
+			results[name] = result
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad benchmark line %q", line)
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				result.NsPerOp = append(result.NsPerOp, value)
+			case "B/op":
+				result.BytesPerOp = append(result.BytesPerOp, value)
+			case "allocs/op":
+				result.AllocsPerOp = append(result.AllocsPerOp, value)
+			}
+		}
+	}
+	return results, nil
+}
+
+// Result - the results of the benchmark, nil if it wasn't run
+func (run *BenchRun) Result(name string) *BenchResult {
+	for i := range run.Results {
+		if run.Results[i].Name == name {
+			return &run.Results[i]
+		}
+	}
+	return nil
+}
+
+// LoadHistory - the history from the file, empty if there is no file yet
+func LoadHistory(path string) (*BenchHistory, error) {
+	history := &BenchHistory{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, history); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return history, nil
+}
+
+// Save - writes the history to the file as indented JSON
+func (h *BenchHistory) Save(path string) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Baseline - the last run with the label, or the last run for an empty
+// label; nil if there is none
+func (h *BenchHistory) Baseline(label string) *BenchRun {
+	for i := len(h.Runs) - 1; i >= 0; i-- {
+		if label == "" || h.Runs[i].Label == label {
+			return &h.Runs[i]
+		}
+	}
+	return nil
+}
+
+// CaptureProfiles - runs the benchmark once more with go test -cpuprofile
+// -memprofile, they go to dir/Name.cpu.out and dir/Name.mem.out with the
+// test binary dir/Name.test for pprof
+func CaptureProfiles(name, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	_, err = GoTest("-run", "^$", "-bench", benchPattern(name), "-count", "1",
+		"-o", filepath.Join(dir, name+".test"),
+		"-cpuprofile", filepath.Join(dir, name+".cpu.out"),
+		"-memprofile", filepath.Join(dir, name+".mem.out"))
+	return err
+}
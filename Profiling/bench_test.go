@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	cases := []struct {
+		A, B     []float64
+		Expected float64
+	}{
+		// no overlap, 2 of C(10, 5) orderings are that extreme
+		{[]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{[]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252},
+		{[]float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{[]float64{10200, 10200, 10200}, []float64{10200, 10200, 10200}, 1},
+		// ties: the normal approximation
+		{[]float64{100, 100, 100, 100, 100}, []float64{120, 120, 120, 120, 120}, 0.003977},
+	}
+
+	for idx, item := range cases {
+		p := mannWhitney(item.A, item.B)
+		if math.Abs(p-item.Expected) > 1e-4 {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, p, item.Expected)
+		}
+	}
+}
+
+func benchRun(label string, ns, allocs []float64) BenchRun {
+	return BenchRun{Label: label, Results: []BenchResult{
+		{Name: "Fast", NsPerOp: ns, BytesPerOp: allocs, AllocsPerOp: allocs},
+	}}
+}
+
+func TestCompareRuns(t *testing.T) {
+	base := benchRun("base", []float64{100, 101, 102, 103, 104}, []float64{50, 50, 50, 50, 50})
+	cases := []struct {
+		Run      BenchRun
+		Expected []bool // regressions of ns/op, B/op, allocs/op
+	}{
+		{benchRun("same", []float64{102, 100, 104, 101, 103}, []float64{50, 50, 50, 50, 50}), []bool{false, false, false}},
+		{benchRun("slower", []float64{120, 121, 122, 123, 124}, []float64{50, 50, 50, 50, 50}), []bool{true, false, false}},
+		// significant, but below the threshold
+		{benchRun("a bit slower", []float64{105, 106, 107, 108, 109}, []float64{51, 51, 51, 51, 51}), []bool{false, false, false}},
+		{benchRun("more allocs", []float64{100, 101, 102, 103, 104}, []float64{60, 60, 60, 60, 60}), []bool{false, true, true}},
+		// too few samples to tell
+		{benchRun("one sample", []float64{200}, []float64{100}), []bool{false, false, false}},
+		{benchRun("faster", []float64{50, 51, 52, 53, 54}, []float64{10, 10, 10, 10, 10}), []bool{false, false, false}},
+	}
+
+	for idx, item := range cases {
+		deltas := CompareRuns(&base, &item.Run, DefaultThresholds)
+		result := []bool{}
+		for _, d := range deltas {
+			result = append(result, d.Regression)
+		}
+		if !reflect.DeepEqual(result, item.Expected) {
+			t.Errorf("[%d] %s: results not match\nGot:\n%v\nExpected:\n%v", idx, item.Run.Label, result, item.Expected)
+		}
+	}
+
+	slower := benchRun("slower", []float64{120, 121, 122, 123, 124}, []float64{50, 50, 50, 50, 50})
+	out := new(bytes.Buffer)
+	WriteDeltas(out, CompareRuns(&base, &slower, DefaultThresholds), DefaultThresholds.Alpha)
+	if !strings.Contains(out.String(), "+19.61% (p=0.008 n=5+5)  REGRESSION") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
+
+func TestBenchHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bench", "history.json")
+
+	history, err := LoadHistory(path)
+	if err != nil || len(history.Runs) != 0 || history.Baseline("") != nil {
+		t.Fatalf("unexpected history of a missing file: %v %v", history, err)
+	}
+
+	history.Runs = append(history.Runs,
+		benchRun("a", []float64{1}, []float64{2}),
+		benchRun("b", []float64{3}, []float64{4}),
+		benchRun("a", []float64{5}, []float64{6}),
+	)
+	if err := history.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadHistory(path)
+	if err != nil || !reflect.DeepEqual(loaded, history) {
+		t.Errorf("history doesn't round trip: %v", err)
+	}
+
+	if base := loaded.Baseline(""); base != &loaded.Runs[2] {
+		t.Errorf("the last run is not the baseline")
+	}
+	if base := loaded.Baseline("b"); base != &loaded.Runs[1] {
+		t.Errorf("the run b is not the baseline")
+	}
+	if base := loaded.Baseline("c"); base != nil {
+		t.Errorf("unexpected baseline %v", base)
+	}
+}
+
+var benchSink []byte
+
+// BenchmarkTiny - a quick one for TestBenchCommand
+func BenchmarkTiny(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchSink = make([]byte, 64)
+	}
+}
+
+func TestParseBenchOutput(t *testing.T) {
+	out := `{"Action":"output","Output":"goos: linux\n"}
+{"Action":"output","Test":"BenchmarkFast","Output":"BenchmarkFast\n"}
+{"Action":"output","Test":"BenchmarkFast","Output":"BenchmarkFast-8 \t"}
+{"Action":"output","Test":"BenchmarkFast","Output":"     100\t   2782432 ns/op\t  559910 B/op\t   10422 allocs/op\n"}
+{"Action":"output","Output":"BenchmarkFast-8 \t     100\t   2782430 ns/op\t  559911 B/op\t   10421 allocs/op\n"}
+{"Action":"output","Output":"BenchmarkIndex-v2 \t     10\t   12.5 ns/op\n"}
+{"Action":"pass"}
+`
+	expected := map[string]*BenchResult{
+		"Fast":     {Name: "Fast", NsPerOp: []float64{2782432, 2782430}, BytesPerOp: []float64{559910, 559911}, AllocsPerOp: []float64{10422, 10421}},
+		"Index-v2": {Name: "Index-v2", NsPerOp: []float64{12.5}},
+	}
+	results, err := parseBenchOutput([]byte(out))
+	if err != nil || !reflect.DeepEqual(results, expected) {
+		t.Errorf("results not match\nGot:\n%v %v\nExpected:\n%v", results, err, expected)
+	}
+	if _, err := parseBenchOutput([]byte("oops")); err == nil {
+		t.Errorf("expected error for output that isn't JSON")
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	history := filepath.Join(dir, "history.json")
+	profiles := filepath.Join(dir, "profiles")
+	args := []string{"bench", "-bench", "^Tiny$", "-count", "5", "-benchtime", "1000x", "-history", history, "-profiles", profiles}
+
+	out := new(bytes.Buffer)
+	if err := run(append(args, "-save", "-label", "first"), out); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out.String())
+	}
+	saved, err := LoadHistory(history)
+	if err != nil || len(saved.Runs) != 1 || saved.Runs[0].Label != "first" || len(saved.Runs[0].Results[0].NsPerOp) != 5 {
+		t.Fatalf("the run is not saved: %v %+v", err, saved)
+	}
+
+	// the baseline allocated nothing
+	for i := range saved.Runs[0].Results[0].AllocsPerOp {
+		saved.Runs[0].Results[0].AllocsPerOp[i] = 0
+		saved.Runs[0].Results[0].BytesPerOp[i] = 0
+	}
+	saved.Save(history)
+
+	out.Reset()
+	err = run(append(args, "-save"), out)
+	if err == nil || !strings.Contains(err.Error(), "regressed: Tiny") {
+		t.Errorf("expected regression, got %v\n%s", err, out.String())
+	}
+	for _, name := range []string{"Tiny.cpu.out", "Tiny.mem.out"} {
+		if stat, err := os.Stat(filepath.Join(profiles, name)); err != nil || stat.Size() == 0 {
+			t.Errorf("no profile %s: %v", name, err)
+		}
+	}
+	if saved, _ := LoadHistory(history); len(saved.Runs) != 1 {
+		t.Errorf("a regressed run is saved")
+	}
+
+	if err := run(append(args, "-baseline", "missing"), out); err == nil {
+		t.Errorf("expected error for a missing baseline")
+	}
+}
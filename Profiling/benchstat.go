@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// BenchDelta - how a metric of a benchmark changed from the baseline,
+// like a line of benchstat
+type BenchDelta struct {
+	Name   string
+	Metric string
+	// Old, New - medians of the samples
+	Old, New float64
+	// Delta - (New - Old) / Old
+	Delta float64
+	// P - p-value of the Mann-Whitney U test, the samples differ if it's small
+	P          float64
+	Samples    [2]int
+	Regression bool
+}
+
+// BenchThresholds - a metric regresses if it grows by more than its
+// threshold and the change is significant at Alpha
+type BenchThresholds struct {
+	Time   float64
+	Allocs float64
+	Alpha  float64
+}
+
+// DefaultThresholds - 10% for ns/op, 5% for B/op and allocs/op
+var DefaultThresholds = BenchThresholds{Time: 0.10, Allocs: 0.05, Alpha: 0.05}
+
+// CompareRuns - deltas of the metrics for benchmarks both runs have
+func CompareRuns(old, new *BenchRun, limits BenchThresholds) []BenchDelta {
+	deltas := []BenchDelta{}
+	for _, result := range new.Results {
+		base := old.Result(result.Name)
+		if base == nil {
+			continue
+		}
+		metrics := []struct {
+			name      string
+			old, new  []float64
+			threshold float64
+		}{
+			{"ns/op", base.NsPerOp, result.NsPerOp, limits.Time},
+			{"B/op", base.BytesPerOp, result.BytesPerOp, limits.Allocs},
+			{"allocs/op", base.AllocsPerOp, result.AllocsPerOp, limits.Allocs},
+		}
+		for _, m := range metrics {
+			if len(m.old) == 0 || len(m.new) == 0 {
+				continue
+			}
+			d := BenchDelta{
+				Name:    result.Name,
+				Metric:  m.name,
+				Old:     median(m.old),
+				New:     median(m.new),
+				P:       mannWhitney(m.old, m.new),
+				Samples: [2]int{len(m.old), len(m.new)},
+			}
+			if d.Old != 0 {
+				d.Delta = (d.New - d.Old) / d.Old
+			} else if d.New != 0 {
+				d.Delta = math.Inf(1)
+			}
+			d.Regression = d.Delta > m.threshold && d.P < limits.Alpha
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas
+}
+
+// WriteDeltas - the deltas as a table, ~ for changes that aren't significant
+func WriteDeltas(out io.Writer, deltas []BenchDelta, alpha float64) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tmetric\told\tnew\tdelta\t")
+	for _, d := range deltas {
+		delta := "~"
+		if d.P < alpha {
+			delta = fmt.Sprintf("%+.2f%%", d.Delta*100)
+		}
+		mark := ""
+		if d.Regression {
+			mark = "REGRESSION"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s (p=%.3f n=%d+%d)\t%s\n",
+			d.Name, d.Metric, formatMetric(d.Metric, d.Old), formatMetric(d.Metric, d.New),
+			delta, d.P, d.Samples[0], d.Samples[1], mark)
+	}
+	return w.Flush()
+}
+
+// formatMetric - ns/op as a duration, B/op in KiB or MiB
+func formatMetric(metric string, v float64) string {
+	switch {
+	case metric == "ns/op":
+		return time.Duration(v).String()
+	case metric == "B/op" && v >= 1<<20:
+		return fmt.Sprintf("%.2fMiB", v/(1<<20))
+	case metric == "B/op" && v >= 1<<10:
+		return fmt.Sprintf("%.2fKiB", v/(1<<10))
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func median(samples []float64) float64 {
+	sorted := append([]float64{}, samples...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// mannWhitney - two-sided p-value of the Mann-Whitney U test: exact for
+// small samples without ties, the normal approximation with tie
+// correction otherwise
+func mannWhitney(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	type sample struct {
+		value float64
+		first bool
+	}
+	all := make([]sample, 0, n1+n2)
+	for _, v := range a {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// ranks, tied values get the mean of their ranks
+	rankSum, ties := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				rankSum += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties += t*t*t - t
+		}
+		i = j
+	}
+	u := rankSum - float64(n1*(n1+1))/2
+
+	if ties == 0 && n1 <= 20 && n2 <= 20 {
+		return exactU(n1, n2, int(u))
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		// every value is the same
+		return 1
+	}
+	// with continuity correction
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// exactU - two-sided p-value of U from its exact distribution:
+// counts[k] - orderings of n1 and n2 samples with U == k
+func exactU(n1, n2, u int) float64 {
+	// counts(i, j) from counts(i-1, j) shifted by j and counts(i, j-1)
+	prev := make([][]float64, n2+1)
+	for j := range prev {
+		prev[j] = []float64{1}
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = []float64{1}
+		for j := 1; j <= n2; j++ {
+			counts := make([]float64, i*j+1)
+			for k, c := range prev[j] {
+				counts[k+j] += c
+			}
+			for k, c := range cur[j-1] {
+				counts[k] += c
+			}
+			cur[j] = counts
+		}
+		prev = cur
+	}
+
+	counts := prev[n2]
+	total, below, above := 0.0, 0.0, 0.0
+	for k, c := range counts {
+		total += c
+		if k <= u {
+			below += c
+		}
+		if k >= u {
+			above += c
+		}
+	}
+	return math.Min(1, 2*math.Min(below, above)/total)
+}
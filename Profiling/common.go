@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
 	"regexp"
 	"strings"
 	// "log"
@@ -13,33 +12,36 @@ import (
 
 const filePath string = "./data/users.txt"
 
-func SlowSearch(out io.Writer) {
-	file, err := os.Open(filePath)
+func SlowSearch(in io.Reader, policy ParsePolicy) (*Result, error) {
+	fileContents, err := ioutil.ReadAll(in)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	fileContents, err := ioutil.ReadAll(file)
-	if err != nil {
-		panic(err)
-	}
-
-	r := regexp.MustCompile("@")
 	seenBrowsers := []string{}
 	uniqueBrowsers := 0
-	foundUsers := ""
+	foundUsers := []FoundUser{}
 
-	lines := strings.Split(string(fileContents), "\n")
+	lines := strings.Split(strings.TrimSuffix(string(fileContents), "\n"), "\n")
+	if len(fileContents) == 0 {
+		lines = nil
+	}
 
-	users := make([]map[string]interface{}, 0)
-	for _, line := range lines {
+	users := make([]map[string]interface{}, len(lines))
+	var badLines []*ParseError
+	start := int64(0)
+	for i, line := range lines {
 		user := make(map[string]interface{})
 		// fmt.Printf("%v %v\n", err, line)
 		err := json.Unmarshal([]byte(line), &user)
 		if err != nil {
-			panic(err)
+			if err := policy.badLine(newParseError(i+1, start, []byte(line), err), &badLines); err != nil {
+				return nil, err
+			}
+			user = nil
 		}
-		users = append(users, user)
+		users[i] = user
+		start += int64(len(line)) + 1
 	}
 
 	for i, user := range users {
@@ -102,10 +104,19 @@ func SlowSearch(out io.Writer) {
 		}
 
 		// log.Println("Android and MSIE user:", user["name"], user["email"])
-		email := r.ReplaceAllString(user["email"].(string), " [at] ")
-		foundUsers += fmt.Sprintf("[%d] %s <%s>\n", i, user["name"], email)
+		foundUsers = append(foundUsers, FoundUser{
+			Line: i,
+			Values: map[string]string{
+				"name":  fmt.Sprint(user["name"]),
+				"email": fmt.Sprint(user["email"]),
+			},
+		})
 	}
 
-	fmt.Fprintln(out, "found users:\n"+foundUsers)
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	return &Result{
+		Fields:   []string{"name", "email"},
+		Users:    foundUsers,
+		Browsers: seenBrowsers,
+		BadLines: badLines,
+	}, nil
 }
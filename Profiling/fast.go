@@ -1,11 +1,7 @@
 package main
 
 import (
-	"bufio"
-	"fmt"
 	"io"
-	"os"
-	"strings"
 
 	jlexer "github.com/mailru/easyjson/jlexer"
 )
@@ -13,8 +9,12 @@ import (
 //easyjson:json
 type User struct {
 	Browsers []string `json:"browsers"`
+	Company  string   `json:"company"`
+	Country  string   `json:"country"`
 	Email    string   `json:"email"`
+	Job      string   `json:"job"`
 	Name     string   `json:"name"`
+	Phone    string   `json:"phone"`
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
@@ -62,10 +62,18 @@ func (out *User) UnmarshalJSON(data []byte) error {
 				}
 				in.Delim(']')
 			}
+		case "company":
+			out.Company = string(in.String())
+		case "country":
+			out.Country = string(in.String())
 		case "email":
 			out.Email = string(in.String())
+		case "job":
+			out.Job = string(in.String())
 		case "name":
 			out.Name = string(in.String())
+		case "phone":
+			out.Phone = string(in.String())
 		default:
 			in.SkipRecursive()
 		}
@@ -79,61 +87,12 @@ func (out *User) UnmarshalJSON(data []byte) error {
 	return in.Error()
 }
 
-// FastSearch - like SlowSearch, but better
-func FastSearch(out io.Writer) {
-	seenBrowsers := map[string]bool{}
-	uniqueBrowsers := 0
-
-	file, err := os.Open(filePath)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-
-	buf := bufio.NewReader(file)
-	i := -1
-
-	fmt.Fprintln(out, "found users:")
-
-	for {
-		line, _, err := buf.ReadLine()
-		if err == io.EOF {
-			break
-		}
-
-		user := &User{}
-		err = user.UnmarshalJSON(line)
-		if err != nil {
-			panic(err)
-		}
-		i++
-
-		isAndroid := false
-		isMSIE := false
-
-		for _, browser := range user.Browsers {
+// androidAndMSIE - the question of SlowSearch
+var androidAndMSIE = MustCompile(`browsers ~ "Android" AND browsers ~ "MSIE"`)
 
-			androidBrowser := strings.Contains(browser, "Android")
-			if androidBrowser {
-				isAndroid = true
-			}
-
-			msieBrowser := strings.Contains(browser, "MSIE")
-			if msieBrowser {
-				isMSIE = true
-			}
-
-			if (androidBrowser || msieBrowser) && !seenBrowsers[browser] {
-				seenBrowsers[browser] = true
-				uniqueBrowsers++
-			}
-		}
-
-		if isAndroid && isMSIE {
-			email := strings.Replace(user.Email, "@", " [at] ", 1)
-			fmt.Fprintf(out, "[%d] %s <%s>\n", i, user.Name, email)
-		}
-	}
-
-	fmt.Fprintln(out, "\nTotal unique browsers", len(seenBrowsers))
+// FastSearch - like SlowSearch, but better
+func FastSearch(in io.Reader, policy ParsePolicy) (*Result, error) {
+	q := *androidAndMSIE
+	q.Policy = policy
+	return q.Find(in)
 }
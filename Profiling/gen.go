@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// Corpus - values users are made of, a value is there as many times as it
+// is in the source, so picking a random one keeps the distribution
+type Corpus struct {
+	Browsers   []string
+	Companies  []string
+	Countries  []string
+	Jobs       []string
+	FirstNames []string
+	LastNames  []string
+	// Locals, Domains - the parts of emails around @
+	Locals  []string
+	Domains []string
+
+	android []string
+	msie    []string
+	// notAndroid, notMSIE - browsers a user without the pair can have
+	notAndroid []string
+	notMSIE    []string
+}
+
+// GenOptions - what Generate makes
+type GenOptions struct {
+	Seed  int64
+	Users int
+	// Browsers - browsers of a user, 4 as in users.txt if 0
+	Browsers int
+	// MatchRate - share of users with both an Android and an MSIE browser,
+	// the rest have no such pair
+	MatchRate float64
+	// MalformedRate - share of lines cut short so they aren't JSON
+	MalformedRate float64
+}
+
+// GenStats - what Generate has made
+type GenStats struct {
+	Users     int
+	Matches   int
+	Malformed int
+}
+
+// LoadCorpus - the corpus of a users file
+func LoadCorpus(path string) (*Corpus, error) {
+	in, err := OpenInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return NewCorpus(in)
+}
+
+// NewCorpus - the corpus of users of in
+func NewCorpus(in io.Reader) (*Corpus, error) {
+	c := &Corpus{}
+	reader := newLineReader(in)
+	user := &User{}
+
+	for i := 0; ; i++ {
+		line, start, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		user.reset()
+		if err := user.UnmarshalJSON(line); err != nil {
+			return nil, newParseError(i+1, start, line, err)
+		}
+
+		for _, browser := range user.Browsers {
+			c.Browsers = append(c.Browsers, browser)
+			if strings.Contains(browser, "Android") {
+				c.android = append(c.android, browser)
+			} else {
+				c.notAndroid = append(c.notAndroid, browser)
+			}
+			if strings.Contains(browser, "MSIE") {
+				c.msie = append(c.msie, browser)
+			} else {
+				c.notMSIE = append(c.notMSIE, browser)
+			}
+		}
+		c.Companies = append(c.Companies, user.Company)
+		c.Countries = append(c.Countries, user.Country)
+		c.Jobs = append(c.Jobs, user.Job)
+		if space := strings.IndexByte(user.Name, ' '); space != -1 {
+			c.FirstNames = append(c.FirstNames, user.Name[:space])
+			c.LastNames = append(c.LastNames, user.Name[space+1:])
+		}
+		if at := strings.IndexByte(user.Email, '@'); at != -1 {
+			c.Locals = append(c.Locals, user.Email[:at])
+			c.Domains = append(c.Domains, user.Email[at+1:])
+		}
+	}
+
+	if len(c.Browsers) == 0 || len(c.FirstNames) == 0 || len(c.Locals) == 0 {
+		return nil, fmt.Errorf("not enough users for a corpus")
+	}
+	return c, nil
+}
+
+// Generate - opts.Users lines of users made of the corpus, the same for the
+// same seed. The users match androidAndMSIE at MatchRate, the malformed
+// lines aren't counted as matches
+func (c *Corpus) Generate(out io.Writer, opts GenOptions) (GenStats, error) {
+	stats := GenStats{}
+	if opts.Browsers == 0 {
+		opts.Browsers = 4
+	}
+	if opts.MatchRate > 0 && (opts.Browsers < 2 || len(c.android) == 0 || len(c.msie) == 0) {
+		return stats, fmt.Errorf("can't make users with Android and MSIE browsers")
+	}
+	// a user with the pair loses the Android browsers, or the MSIE ones if
+	// every browser is Android
+	avoid, others := "Android", c.notAndroid
+	if len(others) == 0 {
+		avoid, others = "MSIE", c.notMSIE
+	}
+	if opts.MatchRate < 1 && len(others) == 0 {
+		return stats, fmt.Errorf("can't make users without Android and MSIE browsers")
+	}
+
+	rnd := rand.New(rand.NewSource(opts.Seed))
+	pick := func(values []string) string { return values[rnd.Intn(len(values))] }
+
+	w := bufio.NewWriter(out)
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	user := &User{}
+
+	for i := 0; i < opts.Users; i++ {
+		user.Browsers = user.Browsers[:0]
+		for j := 0; j < opts.Browsers; j++ {
+			user.Browsers = append(user.Browsers, pick(c.Browsers))
+		}
+
+		match := rnd.Float64() < opts.MatchRate
+		if match {
+			// two different places for the pair
+			a := rnd.Intn(opts.Browsers)
+			b := (a + 1 + rnd.Intn(opts.Browsers-1)) % opts.Browsers
+			user.Browsers[a], user.Browsers[b] = pick(c.android), pick(c.msie)
+		} else if androidAndMSIE.Match(user) {
+			for j, browser := range user.Browsers {
+				if strings.Contains(browser, avoid) {
+					user.Browsers[j] = pick(others)
+				}
+			}
+		}
+
+		first, last := pick(c.FirstNames), pick(c.LastNames)
+		user.Name = first + " " + last
+		user.Company = pick(c.Companies)
+		user.Country = pick(c.Countries)
+		user.Job = pick(c.Jobs)
+		user.Email = pick(c.Locals) + "@" + pick(c.Domains)
+		user.Phone = fmt.Sprintf("%03d-%02d-%02d", rnd.Intn(1000), rnd.Intn(100), rnd.Intn(100))
+
+		buf.Reset()
+		if err := enc.Encode(user); err != nil {
+			return stats, err
+		}
+		line := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+		if rnd.Float64() < opts.MalformedRate {
+			// before the closing brace, so it's never an object
+			line = line[:1+rnd.Intn(len(line)-1)]
+			stats.Malformed++
+		} else if match {
+			stats.Matches++
+		}
+
+		if i > 0 {
+			w.WriteByte('\n')
+		}
+		if _, err := w.Write(line); err != nil {
+			return stats, err
+		}
+		stats.Users++
+	}
+	return stats, w.Flush()
+}
+
+// GenerateFile - Generate into the file at path
+func (c *Corpus) GenerateFile(path string, opts GenOptions) (GenStats, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return GenStats{}, err
+	}
+	stats, err := c.Generate(file, opts)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return stats, err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func genUsers(t testing.TB, opts GenOptions) ([]byte, GenStats) {
+	corpus, err := LoadCorpus(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	stats, err := corpus.Generate(out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes(), stats
+}
+
+func TestGenerate(t *testing.T) {
+	cases := []GenOptions{
+		{Seed: 1, Users: 2000, MatchRate: 0.083},
+		{Seed: 2, Users: 500, MatchRate: 0},
+		{Seed: 3, Users: 500, MatchRate: 1},
+		{Seed: 4, Users: 300, MatchRate: 0.5, Browsers: 2},
+	}
+	for idx, opts := range cases {
+		data, stats := genUsers(t, opts)
+		again, _ := genUsers(t, opts)
+		if !bytes.Equal(data, again) {
+			t.Errorf("[%d] the same seed gives other users", idx)
+		}
+		if lines := bytes.Count(data, []byte{'\n'}) + 1; lines != opts.Users || stats.Users != opts.Users {
+			t.Errorf("[%d] expected %d users, got %d lines, %+v", idx, opts.Users, lines, stats)
+		}
+
+		slow, err := SlowSearch(bytes.NewReader(data), FailFast)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		fast, err := FastSearch(bytes.NewReader(data), FailFast)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		if !sameResult(slow, fast) {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, fast, slow)
+		}
+		if len(fast.Users) != stats.Matches {
+			t.Errorf("[%d] expected %d matches, found %d", idx, stats.Matches, len(fast.Users))
+		}
+	}
+
+	_, stats := genUsers(t, GenOptions{Seed: 5, Users: 10000, MatchRate: 0.25})
+	if stats.Matches < 2300 || stats.Matches > 2700 {
+		t.Errorf("expected about 2500 matches, got %d", stats.Matches)
+	}
+}
+
+func TestGenerateMalformed(t *testing.T) {
+	data, stats := genUsers(t, GenOptions{Seed: 1, Users: 1000, MatchRate: 0.1, MalformedRate: 0.01})
+	if stats.Malformed == 0 {
+		t.Fatalf("no malformed lines: %+v", stats)
+	}
+
+	lines := bytes.Split(data, []byte{'\n'})
+	first := 0
+	for i, line := range lines {
+		if err := (&User{}).UnmarshalJSON(line); err != nil {
+			first = i + 1
+			break
+		}
+	}
+	if first == 0 {
+		t.Fatalf("all the lines are JSON")
+	}
+
+	prefix := "line " + strconv.Itoa(first) + ": "
+	_, slowErr := SlowSearch(bytes.NewReader(data), FailFast)
+	_, fastErr := FastSearch(bytes.NewReader(data), FailFast)
+	for idx, err := range []error{slowErr, fastErr} {
+		if err == nil || !strings.HasPrefix(err.Error(), prefix) {
+			t.Errorf("[%d] expected error on %q, got %v", idx, prefix, err)
+		}
+	}
+}
+
+func TestGenerateStats(t *testing.T) {
+	data, stats := genUsers(t, GenOptions{Seed: 1, Users: 2000, MatchRate: 0.3, MalformedRate: 0.2})
+	query := *androidAndMSIE
+	query.Policy = Collect
+	result, err := query.Find(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Users) != stats.Matches || len(result.BadLines) != stats.Malformed {
+		t.Errorf("results not match\nGot:\n%d %d\nExpected:\n%+v", len(result.Users), len(result.BadLines), stats)
+	}
+
+	// every browser of the corpus has both
+	corpus, err := NewCorpus(strings.NewReader(`{"browsers":["Android 4; MSIE 8"],"name":"A B","email":"a@b.c"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := corpus.Generate(new(bytes.Buffer), GenOptions{Users: 10, Browsers: 1}); err == nil {
+		t.Errorf("expected error for a corpus without browsers that don't match")
+	}
+}
+
+func TestGenCommand(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := run([]string{"gen", "-users", "50", "-seed", "7", "-match", "0.5"}, out); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := genUsers(t, GenOptions{Seed: 7, Users: 50, MatchRate: 0.5, Browsers: 4})
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("results not match\nGot:\n%s\nExpected:\n%s", out.Bytes(), data)
+	}
+}
+
+func FuzzSearch(f *testing.F) {
+	corpus, err := LoadCorpus(filePath)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(int64(1), uint8(20), uint8(10), uint8(0))
+	f.Add(int64(2), uint8(50), uint8(100), uint8(5))
+	f.Add(int64(3), uint8(0), uint8(0), uint8(0))
+	f.Fuzz(func(t *testing.T, seed int64, users, match, malformed uint8) {
+		out := new(bytes.Buffer)
+		opts := GenOptions{
+			Seed:          seed,
+			Users:         int(users),
+			MatchRate:     float64(match) / 255,
+			MalformedRate: float64(malformed) / 255,
+		}
+		if _, err := corpus.Generate(out, opts); err != nil {
+			t.Fatal(err)
+		}
+		slow, slowErr := SlowSearch(bytes.NewReader(out.Bytes()), FailFast)
+		fast, fastErr := FastSearch(bytes.NewReader(out.Bytes()), FailFast)
+		if (slowErr == nil) != (fastErr == nil) {
+			t.Fatalf("errors not match: %v, %v", slowErr, fastErr)
+		}
+		if slowErr == nil && !sameResult(slow, fast) {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fast, slow)
+		}
+	})
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// gramSize - browsers are indexed by substrings of that many bytes
+const gramSize = 3
+
+var indexMagic = []byte("UIDX\x03")
+
+type gram [gramSize]byte
+
+// Index - inverted index of browsers over the complete lines of a
+// JSON-lines file: for every 3-byte substring of the browsers the sorted
+// lines that have it. Lines appended to the file are added by Update,
+// the lines after Size are scanned by Search as they are
+type Index struct {
+	// Size - bytes of the file indexed, they end on a newline
+	Size int64
+	// Offsets - where the lines start
+	Offsets []int64
+	// Bad - the sorted lines that aren't users, Search reads them again
+	// and applies the policy of the query
+	Bad []uint32
+
+	postings map[gram][]uint32
+	// check - FNV-1a of the Size bytes, the file is still the one indexed
+	// if they hash the same
+	check uint64
+}
+
+// BuildIndex - index of size bytes of in
+func BuildIndex(in io.ReaderAt, size int64) (*Index, error) {
+	idx := &Index{}
+	if _, err := idx.Update(in, size); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// OpenIndex - the index of the file from indexPath, updated and saved back
+// if the file has grown; it's built anew if it's missing, broken or of
+// another file
+func OpenIndex(path, indexPath string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{}
+	if data, err := ioutil.ReadFile(indexPath); err == nil {
+		if idx.UnmarshalBinary(data) != nil {
+			idx = &Index{}
+		}
+	}
+
+	changed, err := idx.Update(file, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return idx, nil
+	}
+	return idx, idx.save(indexPath)
+}
+
+// save - writes the index next to the old one and renames it over,
+// so readers never see it half written
+func (idx *Index) save(indexPath string) error {
+	data, err := idx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(indexPath), filepath.Base(indexPath)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), indexPath)
+}
+
+// IndexedSearch - Search through the index at indexPath, which is kept up to date
+func IndexedSearch(out io.Writer, query *Query, indexPath string) error {
+	idx, err := OpenIndex(filePath, indexPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return idx.Search(query, file, stat.Size(), out)
+}
+
+// Update - adds the complete lines after Size, or indexes the file anew if
+// it's shorter or any of the bytes before Size has changed. Reports if the
+// index has changed; lines that aren't users go to Bad
+func (idx *Index) Update(in io.ReaderAt, size int64) (bool, error) {
+	same, err := idx.sameFile(in, size)
+	if err != nil {
+		return false, err
+	}
+	rebuilt := !same
+	if rebuilt {
+		*idx = Index{}
+	}
+	if idx.postings == nil {
+		idx.postings = map[gram][]uint32{}
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(in, idx.Size, size-idx.Size))
+	user := &User{}
+	start := idx.Size
+	check := idx.check
+	if idx.Size == 0 {
+		check = fnvOffset
+	}
+	var readErr error
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// a long line, the rest of it follows; ReadBytes reuses the
+			// buffer line points to
+			line = append([]byte{}, line...)
+			var rest []byte
+			rest, err = reader.ReadBytes('\n')
+			line = append(line, rest...)
+		}
+		if err == io.EOF {
+			// the last line is indexed once it's complete
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+
+		user.reset()
+		if err := user.UnmarshalJSON(bytes.TrimRight(line, "\r\n")); err != nil {
+			idx.Bad = append(idx.Bad, uint32(len(idx.Offsets)))
+		} else {
+			idx.add(uint32(len(idx.Offsets)), user.Browsers)
+		}
+		idx.Offsets = append(idx.Offsets, start)
+		start += int64(len(line))
+		check = fnvAppend(check, line)
+	}
+
+	if start == idx.Size {
+		return rebuilt, readErr
+	}
+	idx.Size, idx.check = start, check
+	return true, readErr
+}
+
+// sameFile - the file starts with what was indexed: all of the Size bytes
+// are read, a change anywhere before Size indexes the file anew
+func (idx *Index) sameFile(in io.ReaderAt, size int64) (bool, error) {
+	if idx.Size == 0 {
+		return true, nil
+	}
+	if size < idx.Size {
+		return false, nil
+	}
+	check := uint64(fnvOffset)
+	buf := make([]byte, 64<<10)
+	for pos := int64(0); pos < idx.Size; {
+		part := buf
+		if rest := idx.Size - pos; rest < int64(len(part)) {
+			part = part[:rest]
+		}
+		n, err := in.ReadAt(part, pos)
+		if n < len(part) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return false, err
+		}
+		check = fnvAppend(check, part)
+		pos += int64(n)
+	}
+	return check == idx.check, nil
+}
+
+// FNV-1a, it goes on from the hash of the bytes before unlike hash/fnv
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+func fnvAppend(hash uint64, data []byte) uint64 {
+	for _, b := range data {
+		hash ^= uint64(b)
+		hash *= fnvPrime
+	}
+	return hash
+}
+
+func (idx *Index) add(line uint32, browsers []string) {
+	for _, browser := range browsers {
+		for i := 0; i+gramSize <= len(browser); i++ {
+			var g gram
+			copy(g[:], browser[i:])
+			lines := idx.postings[g]
+			// the line may have the substring more than once
+			if len(lines) == 0 || lines[len(lines)-1] != line {
+				idx.postings[g] = append(lines, line)
+			}
+		}
+	}
+}
+
+// lookup - lines that have every substring of the value in their browsers,
+// the value itself may still not be there
+func (idx *Index) lookup(value string) []uint32 {
+	var lines []uint32
+	for i := 0; i+gramSize <= len(value); i++ {
+		var g gram
+		copy(g[:], value[i:])
+		if i == 0 {
+			lines = idx.postings[g]
+		} else {
+			lines = intersect(lines, idx.postings[g])
+		}
+		if len(lines) == 0 {
+			return []uint32{}
+		}
+	}
+	return lines
+}
+
+// all - every indexed line
+func (idx *Index) all() []uint32 {
+	lines := make([]uint32, len(idx.Offsets))
+	for i := range lines {
+		lines[i] = uint32(i)
+	}
+	return lines
+}
+
+// Search - Query.Run over size bytes of in with the same output: of the
+// indexed lines only those the index can't rule out are read, the lines
+// after Size are scanned
+func (idx *Index) Search(q *Query, in io.ReaderAt, size int64, out io.Writer) error {
+	lines := idx.all()
+	if q.candidates != nil {
+		lines = q.candidates(idx)
+		// browsers are counted on every line, not only on matching ones
+		for _, cond := range q.browsers {
+			if cond.lookup() == nil {
+				lines = idx.all()
+				break
+			}
+			lines = union(lines, idx.lookup(cond.value))
+		}
+		// the policy of the query decides on the bad lines
+		lines = union(lines, idx.Bad)
+	}
+
+	seenBrowsers := map[string]bool{}
+	user := &User{}
+	buf := []byte{}
+	data := []byte{}
+	var bad []*ParseError
+
+	fmt.Fprintln(out, "found users:")
+
+	for _, i := range lines {
+		end := idx.Size
+		if int(i)+1 < len(idx.Offsets) {
+			end = idx.Offsets[i+1]
+		}
+		if int64(cap(data)) < end-idx.Offsets[i] {
+			data = make([]byte, end-idx.Offsets[i])
+		}
+		data = data[:end-idx.Offsets[i]]
+		if _, err := in.ReadAt(data, idx.Offsets[i]); err != nil && err != io.EOF {
+			return err
+		}
+
+		user.reset()
+		line := bytes.TrimRight(data, "\r\n")
+		if err := user.UnmarshalJSON(line); err != nil {
+			// a bad line, or the file was changed after indexing
+			if err := q.badLine(newParseError(int(i)+1, idx.Offsets[i], line, err), &bad); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, browser := range user.Browsers {
+			if !seenBrowsers[browser] && q.countBrowser(browser) {
+				seenBrowsers[browser] = true
+			}
+		}
+		if q.match(user) {
+			buf = append(buf[:0], '[')
+			buf = strconv.AppendInt(buf, int64(i), 10)
+			buf = append(buf, "] "...)
+			buf = q.appendFields(buf, user)
+			buf = append(buf, '\n')
+			if _, err := out.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	if size > idx.Size {
+		tail := chunkTask{idx.Size, size, &chunkResult{}}
+		q.scanChunk(in, tail)
+		if err := tail.result.merge(len(idx.Offsets), &bad); err != nil {
+			return err
+		}
+		for _, match := range tail.result.matches {
+			buf = append(buf[:0], '[')
+			buf = strconv.AppendInt(buf, int64(len(idx.Offsets)+match.line), 10)
+			buf = append(buf, "] "...)
+			buf = append(buf, tail.result.text[match.start:match.end]...)
+			buf = append(buf, '\n')
+			if _, err := out.Write(buf); err != nil {
+				return err
+			}
+		}
+		for _, browser := range tail.result.browsers {
+			seenBrowsers[browser] = true
+		}
+	}
+
+	fmt.Fprintln(out, "\nTotal unique browsers", len(seenBrowsers))
+	return writeBadLines(out, bad)
+}
+
+// MarshalBinary - the index as
+//
+//	magic, size, check, line count, line offset deltas,
+//	bad line count, bad line deltas,
+//	gram count, then for every gram: 3 bytes, line count, line deltas
+//
+// numbers are uvarints except the 8 byte check, grams are sorted
+func (idx *Index) MarshalBinary() ([]byte, error) {
+	data := append([]byte{}, indexMagic...)
+	data = binary.AppendUvarint(data, uint64(idx.Size))
+	data = binary.LittleEndian.AppendUint64(data, idx.check)
+
+	data = binary.AppendUvarint(data, uint64(len(idx.Offsets)))
+	prev := int64(0)
+	for _, offset := range idx.Offsets {
+		data = binary.AppendUvarint(data, uint64(offset-prev))
+		prev = offset
+	}
+	data = appendLines(data, idx.Bad)
+
+	grams := make([]gram, 0, len(idx.postings))
+	for g := range idx.postings {
+		grams = append(grams, g)
+	}
+	sort.Slice(grams, func(i, j int) bool { return bytes.Compare(grams[i][:], grams[j][:]) < 0 })
+
+	data = binary.AppendUvarint(data, uint64(len(grams)))
+	for _, g := range grams {
+		data = append(data, g[:]...)
+		data = appendLines(data, idx.postings[g])
+	}
+	return data, nil
+}
+
+// appendLines - count and deltas of the sorted lines
+func appendLines(data []byte, lines []uint32) []byte {
+	data = binary.AppendUvarint(data, uint64(len(lines)))
+	prev := uint32(0)
+	for _, line := range lines {
+		data = binary.AppendUvarint(data, uint64(line-prev))
+		prev = line
+	}
+	return data
+}
+
+var errBadIndex = errors.New("bad index")
+
+// UnmarshalBinary - the index from MarshalBinary
+func (idx *Index) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, indexMagic) {
+		return errBadIndex
+	}
+	data = data[len(indexMagic):]
+
+	next := func() uint64 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			data = nil
+			return 0
+		}
+		data = data[size:]
+		return n
+	}
+	// nextLines - nil unless the lines are sorted, unique and indexed
+	nextLines := func() []uint32 {
+		count := next()
+		if count > uint64(len(data)) {
+			return nil
+		}
+		lines := make([]uint32, count)
+		prev := uint64(0)
+		for i := range lines {
+			delta := next()
+			if i > 0 && delta == 0 || delta >= uint64(len(idx.Offsets))-prev {
+				return nil
+			}
+			prev += delta
+			lines[i] = uint32(prev)
+		}
+		return lines
+	}
+
+	*idx = Index{Size: int64(next()), postings: map[gram][]uint32{}}
+	if len(data) < 8 || idx.Size < 0 {
+		return errBadIndex
+	}
+	idx.check = binary.LittleEndian.Uint64(data)
+	data = data[8:]
+
+	count := next()
+	if count > uint64(len(data)) {
+		return errBadIndex
+	}
+	// every line starts after the one before it and ends by Size
+	idx.Offsets = make([]int64, count)
+	prev := uint64(0)
+	for i := range idx.Offsets {
+		delta := next()
+		if i > 0 && delta == 0 || delta >= uint64(idx.Size)-prev {
+			return errBadIndex
+		}
+		prev += delta
+		idx.Offsets[i] = int64(prev)
+	}
+	if idx.Bad = nextLines(); idx.Bad == nil {
+		return errBadIndex
+	}
+	if len(idx.Bad) == 0 {
+		idx.Bad = nil
+	}
+
+	grams := next()
+	for ; grams > 0; grams-- {
+		if len(data) < gramSize {
+			return errBadIndex
+		}
+		var g gram
+		copy(g[:], data)
+		data = data[gramSize:]
+
+		lines := nextLines()
+		if lines == nil {
+			return errBadIndex
+		}
+		idx.postings[g] = lines
+	}
+
+	if data == nil || len(data) != 0 {
+		return errBadIndex
+	}
+	return nil
+}
+
+// intersect - lines in both sorted lists
+func intersect(a, b []uint32) []uint32 {
+	lines := []uint32{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			lines = append(lines, a[i])
+			i++
+			j++
+		}
+	}
+	return lines
+}
+
+// union - lines in any of the sorted lists
+func union(a, b []uint32) []uint32 {
+	lines := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			lines = append(lines, a[i])
+			i++
+		case a[i] > b[j]:
+			lines = append(lines, b[j])
+			j++
+		default:
+			lines = append(lines, a[i])
+			i++
+			j++
+		}
+	}
+	lines = append(lines, a[i:]...)
+	return append(lines, b[j:]...)
+}
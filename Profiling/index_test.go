@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var indexQueries = []string{
+	`browsers ~ "Android" AND browsers ~ "MSIE"`,
+	`SELECT name, browsers WHERE browsers ~ "Opera" OR browsers = "Mozilla/5.0"`,
+	`SELECT name, country WHERE country = "Peru" AND browsers ~ "Chrome"`,
+	`SELECT email WHERE browsers ~ "Android" AND NOT browsers ~ "Mobile"`,
+	`browsers ~ "MS" OR job ~ "Engineer"`,
+	`browsers ~ "no such browser"`,
+	``,
+}
+
+func TestIndexSearch(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last lines aren't indexed yet, Search scans them
+	indexed := bytes.LastIndexByte(data[:len(data)*3/4], '\n') + 1
+
+	idx, err := BuildIndex(bytes.NewReader(data[:indexed]), int64(indexed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx2, src := range indexQueries {
+		query := MustCompile(src)
+		expected, result := new(bytes.Buffer), new(bytes.Buffer)
+		query.Run(bytes.NewReader(data), expected)
+		if err := idx.Search(query, bytes.NewReader(data), int64(len(data)), result); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx2, err)
+		}
+		if result.String() != expected.String() {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx2, result.String(), expected.String())
+		}
+	}
+}
+
+func TestIndexUpdate(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := BuildIndex(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// half a line at the end isn't indexed until the rest of it comes
+	idx, _ := BuildIndex(bytes.NewReader(data[:len(data)/2]), int64(len(data)/2))
+	changed, err := idx.Update(bytes.NewReader(data), int64(len(data)))
+	if err != nil || !changed {
+		t.Fatalf("unexpected update: %v %v", changed, err)
+	}
+	if !reflect.DeepEqual(idx, full) {
+		t.Errorf("incremental index differs from the full one")
+	}
+	if changed, _ := idx.Update(bytes.NewReader(data), int64(len(data))); changed {
+		t.Errorf("index changed without new lines")
+	}
+
+	// a change early in the file that keeps its size
+	edited := append([]byte{}, data...)
+	at := bytes.Index(edited, []byte("MSIE"))
+	copy(edited[at:], "MSIX")
+	editedIdx, _ := BuildIndex(bytes.NewReader(edited), int64(len(edited)))
+	if changed, err := idx.Update(bytes.NewReader(edited), int64(len(edited))); err != nil || !changed {
+		t.Fatalf("unexpected update: %v %v", changed, err)
+	}
+	if !reflect.DeepEqual(idx, editedIdx) {
+		t.Errorf("index of the edited file differs from the new one")
+	}
+
+	// another file of the same size is indexed anew
+	half := bytes.IndexByte(data[len(data)/2:], '\n') + len(data)/2 + 1
+	other := append(append(append([]byte{}, data[half:]...), '\n'), data[:half-1]...)
+	otherIdx, _ := BuildIndex(bytes.NewReader(other), int64(len(other)))
+	if changed, err := idx.Update(bytes.NewReader(other), int64(len(other))); err != nil || !changed {
+		t.Fatalf("unexpected update: %v %v", changed, err)
+	}
+	if !reflect.DeepEqual(idx, otherIdx) {
+		t.Errorf("rebuilt index differs from the new one")
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, indexPath := filepath.Join(dir, "users.txt"), filepath.Join(dir, "users.idx")
+	if err := ioutil.WriteFile(path, data[:len(data)/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenIndex(path, indexPath); err != nil {
+		t.Fatal(err)
+	}
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.Write(data[len(data)/3:])
+	file.Close()
+	idx, err := OpenIndex(path, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := &Index{}
+	if err := loaded.UnmarshalBinary(saved); err != nil {
+		t.Fatal(err)
+	}
+	full, _ := BuildIndex(bytes.NewReader(data), int64(len(data)))
+	if !reflect.DeepEqual(idx, full) || !reflect.DeepEqual(loaded, full) {
+		t.Errorf("saved index differs from the full one")
+	}
+
+	for i := 0; i < len(saved); i += 1 + i/16 {
+		if err := new(Index).UnmarshalBinary(saved[:i]); err == nil {
+			t.Errorf("no error for %d bytes of %d", i, len(saved))
+			break
+		}
+	}
+
+	// a broken index is built anew
+	ioutil.WriteFile(indexPath, saved[:len(saved)/2], 0644)
+	if idx, err := OpenIndex(path, indexPath); err != nil || !reflect.DeepEqual(idx, full) {
+		t.Errorf("broken index is not rebuilt: %v", err)
+	}
+
+	// indexes that parse, but don't fit together
+	abc := gram{'a', 'b', 'c'}
+	cases := []*Index{
+		{Size: 10, Offsets: []int64{0}, postings: map[gram][]uint32{abc: {5}}},
+		{Size: 10, Offsets: []int64{0, 4}, postings: map[gram][]uint32{abc: {1, 1}}},
+		{Size: 10, Offsets: []int64{0}, Bad: []uint32{1}},
+		{Size: 10, Offsets: []int64{0, 0}},
+		{Size: 10, Offsets: []int64{4, 2}},
+		{Size: 10, Offsets: []int64{0, 10}},
+	}
+	for i, bad := range cases {
+		data, _ := bad.MarshalBinary()
+		if err := new(Index).UnmarshalBinary(data); err != errBadIndex {
+			t.Errorf("[%d] expected errBadIndex, got %v", i, err)
+		}
+		ioutil.WriteFile(indexPath, data, 0644)
+		if idx, err := OpenIndex(path, indexPath); err != nil || !reflect.DeepEqual(idx, full) {
+			t.Errorf("[%d] bad index is not rebuilt: %v", i, err)
+		}
+	}
+}
+
+func TestIndexBadLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path, indexPath := filepath.Join(dir, "users.txt"), filepath.Join(dir, "users.idx")
+	if err := ioutil.WriteFile(path, []byte(badFixture+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := OpenIndex(path, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(idx.Bad, []uint32{1, 4}) || len(idx.Offsets) != 6 {
+		t.Fatalf("bad lines not indexed: %v of %d", idx.Bad, len(idx.Offsets))
+	}
+	// the saved index is up to date, the bad lines aren't read again
+	saved, _ := ioutil.ReadFile(indexPath)
+	loaded := &Index{}
+	if err := loaded.UnmarshalBinary(saved); err != nil || !reflect.DeepEqual(loaded, idx) {
+		t.Fatalf("saved index differs: %v", err)
+	}
+	if changed, err := loaded.Update(bytes.NewReader([]byte(badFixture+"\n")), int64(len(badFixture)+1)); changed || err != nil {
+		t.Errorf("unexpected update: %v %v", changed, err)
+	}
+
+	for _, src := range []string{`SELECT name WHERE browsers ~ "MSIE"`, `name = "C"`} {
+		for _, policy := range []ParsePolicy{FailFast, Skip, Collect} {
+			query := MustCompile(src)
+			query.Policy = policy
+			expected, result := new(bytes.Buffer), new(bytes.Buffer)
+			expectedErr := query.Run(strings.NewReader(badFixture+"\n"), expected)
+			err := idx.Search(query, strings.NewReader(badFixture+"\n"), int64(len(badFixture)+1), result)
+			if fmt.Sprint(err) != fmt.Sprint(expectedErr) || result.String() != expected.String() {
+				t.Errorf("[%s %d] results not match\nGot:\n%v %.300s\nExpected:\n%v %.300s", src, policy, err, result.String(), expectedErr, expected.String())
+			}
+		}
+	}
+}
+
+func TestIndexedSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	slowResult := searchText(t, SlowSearch)
+
+	out := new(bytes.Buffer)
+	if err := IndexedSearch(out, androidAndMSIE, filepath.Join(dir, "users.idx")); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != slowResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), slowResult)
+	}
+}
+
+func BenchmarkIndexed(b *testing.B) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	stat, _ := file.Stat()
+	idx, err := BuildIndex(file, stat.Size())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Search(androidAndMSIE, file, stat.Size(), ioutil.Discard)
+	}
+}
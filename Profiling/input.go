@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// OpenInput - the file at the path, or stdin for "-", decompressed if it's
+// gzip or zstd
+func OpenInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return Decompress(ioutil.NopCloser(os.Stdin))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	in, err := Decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return in, nil
+}
+
+// Decompress - in as it is, or decompressed if it starts like gzip or zstd;
+// closing the result closes in
+func Decompress(in io.ReadCloser) (io.ReadCloser, error) {
+	reader := bufio.NewReader(in)
+	// a short input is neither, Peek tells it with an error
+	head, _ := reader.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressed{gz, func() { gz.Close() }, in}, nil
+	case bytes.HasPrefix(head, zstdMagic):
+		zr, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressed{zr, zr.Close, in}, nil
+	}
+	return &decompressed{reader, func() {}, in}, nil
+}
+
+type decompressed struct {
+	io.Reader
+	release func()
+	source  io.Closer
+}
+
+func (d *decompressed) Close() error {
+	d.release()
+	return d.source.Close()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestOpenInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gzBuf := new(bytes.Buffer)
+	gz := gzip.NewWriter(gzBuf)
+	gz.Write(data)
+	gz.Close()
+
+	zstdBuf := new(bytes.Buffer)
+	zw, _ := zstd.NewWriter(zstdBuf)
+	zw.Write(data)
+	zw.Close()
+
+	files := map[string][]byte{
+		"users.txt":     data,
+		"users.txt.gz":  gzBuf.Bytes(),
+		"users.txt.zst": zstdBuf.Bytes(),
+		"empty.txt":     {},
+		"short.txt":     []byte("{}"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		in, err := OpenInput(path)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(in)
+		in.Close()
+		expected := content
+		if strings.HasPrefix(name, "users") {
+			expected = data
+		}
+		if err != nil || !bytes.Equal(got, expected) {
+			t.Errorf("%s: %d bytes read, expected %d: %v", name, len(got), len(expected), err)
+		}
+	}
+
+	if _, err := OpenInput(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+	if _, err := OpenInput(""); err == nil {
+		t.Errorf("expected error for an empty path")
+	}
+
+	broken := filepath.Join(dir, "broken.gz")
+	ioutil.WriteFile(broken, gzBuf.Bytes()[:5], 0644)
+	if _, err := OpenInput(broken); err == nil {
+		t.Errorf("expected error for a broken gzip header")
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "users.txt.gz")
+	file, _ := os.Create(path)
+	gz := gzip.NewWriter(file)
+	io.WriteString(gz, resultFixture)
+	gz.Close()
+	file.Close()
+
+	out := new(bytes.Buffer)
+	if err := run([]string{"search", "-file", path, "-format", "csv", `SELECT name WHERE country = "Peru"`}, out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "line,name\n0,\"A, Jr.\"\n1,B\n"
+	if out.String() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out.String(), expected)
+	}
+
+	if err := run([]string{"search", "-file", path, "-format", "xml"}, out); err == nil {
+		t.Errorf("expected error for an unknown format")
+	}
+	if err := run([]string{"search", "-file", path, "name"}, out); err == nil {
+		t.Errorf("expected error for a bad query")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// go build -o users . && zcat users.txt.gz | users search -file - -format json 'browsers ~ "MSIE"'
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// commands - subcommands by name, they get the arguments after the name
+var commands = map[string]func(args []string, out io.Writer) error{
+	"search": searchCommand,
+	"report": reportCommand,
+	"bench":  benchCommand,
+	"gen":    genCommand,
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 || commands[args[0]] == nil {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("usage: users %s [flags]", strings.Join(names, "|"))
+	}
+	return commands[args[0]](args[1:], out)
+}
+
+// tokenKeyEnv - the variable with the secret key of token redaction, it's
+// not a flag so it doesn't get into shell history
+const tokenKeyEnv = "USERS_TOKEN_KEY"
+
+// users search [-file users.txt] [-format text|csv|json] [-bad fail|skip|collect] [-redact email=partial]
+// 'SELECT name WHERE browsers ~ "MSIE"'
+func searchCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	path := flags.String("file", filePath, "JSON-lines file with users, gzip or zstd too, - for stdin")
+	format := flags.String("format", "text", "text, csv or json")
+	bad := flags.String("bad", "fail", "what to do with lines that aren't users: fail, skip or collect")
+	redact := flags.String("redact", "", "redaction of output fields, like email=partial,phone=phone,name=initials;\n"+
+		"styles: partial, hash, domain, phone, initials, token (keyed by $"+tokenKeyEnv+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	write, ok := ResultFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	policy, ok := ParsePolicies[*bad]
+	if !ok {
+		return fmt.Errorf("unknown policy %q", *bad)
+	}
+	query, err := Compile(strings.Join(flags.Args(), " "))
+	if err != nil {
+		return err
+	}
+	query.Policy = policy
+	if query.Redact, err = ParseRedaction(*redact, []byte(os.Getenv(tokenKeyEnv))); err != nil {
+		return err
+	}
+	in, err := OpenInput(*path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	result, err := query.Find(in)
+	if err != nil {
+		return err
+	}
+	return write(result, out)
+}
+
+// users report [-file users.txt] [-by country] [-top 10] [-format text|csv|json] [-bad fail|skip|collect]
+func reportCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	path := flags.String("file", filePath, "JSON-lines file with users, gzip or zstd too, - for stdin")
+	by := flags.String("by", "country", "user field of the rows: country, company, job, ...")
+	top := flags.Int("top", 0, "columns for that many most used browser families, the rest go to Other")
+	format := flags.String("format", "text", "text, csv or json")
+	bad := flags.String("bad", "fail", "what to do with lines that aren't users: fail, skip or collect")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	write, ok := ReportFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	policy, ok := ParsePolicies[*bad]
+	if !ok {
+		return fmt.Errorf("unknown policy %q", *bad)
+	}
+	in, err := OpenInput(*path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	report, err := BuildReport(in, *by, *top, policy)
+	if err != nil {
+		return err
+	}
+	return write(report, out)
+}
+
+// users bench [-bench Fast] [-count 5] [-baseline label] [-save -label label]
+// runs the benchmarks of the tests with go test, in the directory of the
+// package, and fails if they regress from the baseline in the history;
+// profiles of the regressed ones go to the profiles directory
+func benchCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	pattern := flags.String("bench", ".", "benchmarks to run, a regexp")
+	count := flags.Int("count", 5, "runs of every benchmark")
+	benchtime := flags.String("benchtime", "", "time or iterations of a run, like 2s or 100x")
+	historyPath := flags.String("history", "./bench/history.json", "JSON file with the runs")
+	baseline := flags.String("baseline", "", "label of the run to compare with, the last run if empty")
+	save := flags.Bool("save", false, "add the run to the history if nothing regressed")
+	label := flags.String("label", "", "label of the run, like a commit hash")
+	profiles := flags.String("profiles", "./bench/profiles", "directory for profiles of regressed benchmarks")
+	limits := DefaultThresholds
+	flags.Float64Var(&limits.Time, "threshold", limits.Time, "ns/op growth that is a regression")
+	flags.Float64Var(&limits.Allocs, "alloc-threshold", limits.Allocs, "B/op and allocs/op growth that is a regression")
+	flags.Float64Var(&limits.Alpha, "alpha", limits.Alpha, "significance level")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	re, err := regexp.Compile(*pattern)
+	if err != nil {
+		return err
+	}
+	history, err := LoadHistory(*historyPath)
+	if err != nil {
+		return err
+	}
+
+	run, err := RunBenchmarks(re, *count, *benchtime)
+	if err != nil {
+		return err
+	}
+	run.Label = *label
+
+	regressed := map[string]bool{}
+	if base := history.Baseline(*baseline); base != nil {
+		fmt.Fprintf(out, "baseline %q of %s\n", base.Label, base.Time.Format(time.RFC3339))
+		deltas := CompareRuns(base, &run, limits)
+		if err := WriteDeltas(out, deltas, limits.Alpha); err != nil {
+			return err
+		}
+		for _, d := range deltas {
+			if d.Regression {
+				regressed[d.Name] = true
+			}
+		}
+	} else if *baseline != "" {
+		return fmt.Errorf("no run %q in %s", *baseline, *historyPath)
+	} else {
+		fmt.Fprintln(out, "no baseline yet")
+	}
+
+	if len(regressed) > 0 {
+		names := []string{}
+		for name := range regressed {
+			names = append(names, name)
+			if err := CaptureProfiles(name, *profiles); err != nil {
+				return err
+			}
+		}
+		sort.Strings(names)
+		return fmt.Errorf("regressed: %s, profiles are in %s", strings.Join(names, ", "), *profiles)
+	}
+
+	if *save {
+		history.Runs = append(history.Runs, run)
+		return history.Save(*historyPath)
+	}
+	return nil
+}
+
+// users gen [-users 100000] [-seed 1] [-match 0.083] [-malformed 0] [-o big.txt]
+// makes users like the ones of the corpus file
+func genCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	corpusPath := flags.String("corpus", filePath, "JSON-lines file with users to take values from")
+	output := flags.String("o", "", "file for the users, stdout if empty")
+	opts := GenOptions{}
+	flags.Int64Var(&opts.Seed, "seed", 1, "seed of the random values, the same seed gives the same users")
+	flags.IntVar(&opts.Users, "users", 1000, "users to make")
+	flags.IntVar(&opts.Browsers, "browsers", 4, "browsers of a user")
+	flags.Float64Var(&opts.MatchRate, "match", 0.083, "share of users with Android and MSIE browsers")
+	flags.Float64Var(&opts.MalformedRate, "malformed", 0, "share of lines that aren't JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	corpus, err := LoadCorpus(*corpusPath)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = corpus.Generate(out, opts)
+		return err
+	}
+	stats, err := corpus.GenerateFile(*output, opts)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%d users, %d matches, %d malformed\n", stats.Users, stats.Matches, stats.Malformed)
+	return err
+}
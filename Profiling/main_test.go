@@ -2,32 +2,77 @@ package main
 
 import (
 	"bytes"
-	"io/ioutil"
+	"io"
+	"os"
+	"reflect"
+	"sort"
 	"testing"
 )
 
 // запускаем перед основными функциями по разу чтобы файл остался в памяти в файловом кеше
-// ioutil.Discard - это ioutil.Writer который никуда не пишет
 func init() {
-	SlowSearch(ioutil.Discard)
-	FastSearch(ioutil.Discard)
+	search(SlowSearch)
+	search(FastSearch)
+}
+
+// search - the search over users.txt, failing on bad lines
+func search(find func(in io.Reader, policy ParsePolicy) (*Result, error)) (*Result, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return find(file, FailFast)
+}
+
+// searchText - the search over users.txt as text
+func searchText(t testing.TB, find func(in io.Reader, policy ParsePolicy) (*Result, error)) string {
+	result, err := search(find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	result.WriteText(out)
+	return out.String()
+}
+
+// sameResult - the results are the same but for the order of browsers,
+// SlowSearch and FastSearch see browsers of a user in different orders
+func sameResult(a, b *Result) bool {
+	sorted := func(r *Result) *Result {
+		c := *r
+		c.Browsers = append([]string{}, r.Browsers...)
+		sort.Strings(c.Browsers)
+		return &c
+	}
+	return reflect.DeepEqual(sorted(a), sorted(b))
 }
 
 // -----
 // go test -v
 
 func TestSearch(t *testing.T) {
-	slowOut := new(bytes.Buffer)
-	SlowSearch(slowOut)
-	slowResult := slowOut.String()
-
-	fastOut := new(bytes.Buffer)
-	FastSearch(fastOut)
-	fastResult := fastOut.String()
+	slowResult, err := search(SlowSearch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastResult, err := search(FastSearch)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	if slowResult != fastResult {
+	if !sameResult(slowResult, fastResult) {
 		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastResult, slowResult)
 	}
+
+	// Run prints the same as the result does
+	fastOut := new(bytes.Buffer)
+	if err := Search(fastOut, androidAndMSIE); err != nil {
+		t.Fatal(err)
+	}
+	if slowText := searchText(t, SlowSearch); fastOut.String() != slowText {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastOut.String(), slowText)
+	}
 }
 
 // -----
@@ -35,12 +80,12 @@ func TestSearch(t *testing.T) {
 
 func BenchmarkSlow(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		SlowSearch(ioutil.Discard)
+		search(SlowSearch)
 	}
 }
 
 func BenchmarkFast(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		FastSearch(ioutil.Discard)
+		search(FastSearch)
 	}
 }
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ParallelScanner - runs queries over byte ranges of a JSON-lines file at
+// once; the ranges end on newlines and are ChunkSize long or a bit longer
+type ParallelScanner struct {
+	Workers   int
+	ChunkSize int64
+}
+
+// DefaultScanner - the scanner of ParallelSearch
+var DefaultScanner = ParallelScanner{Workers: runtime.NumCPU(), ChunkSize: 4 << 20}
+
+var (
+	userPool  = sync.Pool{New: func() interface{} { return &User{} }}
+	chunkPool = sync.Pool{New: func() interface{} { return new([]byte) }}
+)
+
+type chunkTask struct {
+	start, end int64
+	result     *chunkResult
+}
+
+// chunkMatch - a matched line, its fields are text[start:end] of the chunk
+type chunkMatch struct {
+	line       int
+	start, end int
+}
+
+type chunkResult struct {
+	lines    int
+	matches  []chunkMatch
+	text     []byte
+	browsers []string // in the order they were first seen in the chunk
+	// bad, err - their lines are counted from the chunk start till merge
+	bad  []*ParseError
+	err  error
+	done chan struct{}
+}
+
+// ParallelSearch - Search with DefaultScanner
+func ParallelSearch(out io.Writer, query *Query) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return DefaultScanner.Run(query, file, stat.Size(), out)
+}
+
+// Run - Query.Run over size bytes of in with the same output: chunks are
+// parsed at once, their results are merged in the order of the file
+func (s ParallelScanner) Run(q *Query, in io.ReaderAt, size int64, out io.Writer) error {
+	workers, chunkSize := s.Workers, s.ChunkSize
+	if workers < 1 {
+		workers = 1
+	}
+	if chunkSize < 1 {
+		chunkSize = DefaultScanner.ChunkSize
+	}
+
+	tasks := make(chan chunkTask)
+	// results in the order of chunks, the buffer limits how far workers go ahead
+	ordered := make(chan *chunkResult, 2*workers)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(tasks)
+		defer close(ordered)
+		for start := int64(0); start < size; {
+			result := &chunkResult{done: make(chan struct{})}
+			end, err := lineEnd(in, start+chunkSize, size)
+			if err != nil {
+				result.err = err
+				close(result.done)
+			}
+
+			select {
+			case ordered <- result:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+			select {
+			case tasks <- chunkTask{start, end, result}:
+			case <-stop:
+				return
+			}
+			start = end
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range tasks {
+				select {
+				case <-stop:
+				default:
+					q.scanChunk(in, task)
+				}
+				close(task.result.done)
+			}
+		}()
+	}
+
+	seenBrowsers := map[string]bool{}
+	buf := []byte{}
+	lines := 0
+	var bad []*ParseError
+
+	fmt.Fprintln(out, "found users:")
+
+	for result := range ordered {
+		<-result.done
+		if err := result.merge(lines, &bad); err != nil {
+			return err
+		}
+
+		for _, match := range result.matches {
+			buf = append(buf[:0], '[')
+			buf = strconv.AppendInt(buf, int64(lines+match.line), 10)
+			buf = append(buf, "] "...)
+			buf = append(buf, result.text[match.start:match.end]...)
+			buf = append(buf, '\n')
+			if _, err := out.Write(buf); err != nil {
+				return err
+			}
+		}
+		for _, browser := range result.browsers {
+			seenBrowsers[browser] = true
+		}
+		lines += result.lines
+	}
+
+	fmt.Fprintln(out, "\nTotal unique browsers", len(seenBrowsers))
+	return writeBadLines(out, bad)
+}
+
+// merge - numbers the bad lines of the chunk from the file start, there are
+// that many lines before it; the error of the chunk if there is one
+func (r *chunkResult) merge(lines int, bad *[]*ParseError) error {
+	for _, err := range r.bad {
+		err.Line += lines + 1
+	}
+	*bad = append(*bad, r.bad...)
+	if parseErr, ok := r.err.(*ParseError); ok {
+		parseErr.Line += lines + 1
+	}
+	return r.err
+}
+
+// scanChunk - the lines of the chunk one by one, like Query.Run
+func (q *Query) scanChunk(in io.ReaderAt, task chunkTask) {
+	result := task.result
+
+	dataPtr := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(dataPtr)
+	if int64(cap(*dataPtr)) < task.end-task.start {
+		*dataPtr = make([]byte, task.end-task.start)
+	}
+	data := (*dataPtr)[:task.end-task.start]
+	if _, err := in.ReadAt(data, task.start); err != nil && err != io.EOF {
+		result.err = err
+		return
+	}
+
+	user := userPool.Get().(*User)
+	defer userPool.Put(user)
+	var seen map[string]bool
+	if len(q.browsers) > 0 {
+		seen = map[string]bool{}
+	}
+
+	for pos := task.start; len(data) > 0; {
+		line, start := data, pos
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			line, data = data[:i], data[i+1:]
+			pos += int64(i) + 1
+		} else {
+			data = nil
+		}
+		// like bufio.Reader.ReadLine
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+
+		user.reset()
+		if err := user.UnmarshalJSON(line); err != nil {
+			if err := q.badLine(newParseError(result.lines, start, line, err), &result.bad); err != nil {
+				result.err = err
+				return
+			}
+			result.lines++
+			continue
+		}
+
+		if seen != nil {
+			for _, browser := range user.Browsers {
+				if !seen[browser] && q.countBrowser(browser) {
+					seen[browser] = true
+					result.browsers = append(result.browsers, browser)
+				}
+			}
+		}
+
+		if q.match(user) {
+			start := len(result.text)
+			result.text = q.appendFields(result.text, user)
+			result.matches = append(result.matches, chunkMatch{result.lines, start, len(result.text)})
+		}
+		result.lines++
+	}
+}
+
+// lineEnd - position right after the first newline at or after pos,
+// or size if there's none
+func lineEnd(in io.ReaderAt, pos, size int64) (int64, error) {
+	if pos <= 0 {
+		return 0, nil
+	}
+	buf := make([]byte, 4096)
+	// the chunk may end right on a newline
+	pos--
+	for pos < size {
+		n, err := in.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+			return pos + int64(i) + 1, nil
+		}
+		pos += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParallelSearch(t *testing.T) {
+	slowResult := searchText(t, SlowSearch)
+
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scanner := range []ParallelScanner{
+		DefaultScanner,
+		{Workers: 1, ChunkSize: 1},
+		{Workers: 3, ChunkSize: 1000},
+		{Workers: 8, ChunkSize: 4096},
+		{Workers: 16, ChunkSize: int64(len(data))},
+	} {
+		out := new(bytes.Buffer)
+		if err := scanner.Run(androidAndMSIE, bytes.NewReader(data), int64(len(data)), out); err != nil {
+			t.Errorf("%+v: unexpected error: %v", scanner, err)
+			continue
+		}
+		if out.String() != slowResult {
+			t.Errorf("%+v: results not match\nGot:\n%v\nExpected:\n%v", scanner, out.String(), slowResult)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if err := ParallelSearch(out, androidAndMSIE); err != nil || out.String() != slowResult {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v\nerror: %v", out.String(), slowResult, err)
+	}
+}
+
+func TestParallelQueries(t *testing.T) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := ParallelScanner{Workers: 4, ChunkSize: 2048}
+
+	for _, src := range []string{
+		`SELECT name, company, country, job, phone WHERE country = "Peru" OR browsers ~ "Opera"`,
+		`SELECT browsers WHERE NOT job ~ "Engineer"`,
+		``,
+	} {
+		query := MustCompile(src)
+		expected, result := new(bytes.Buffer), new(bytes.Buffer)
+		query.Run(bytes.NewReader(data), expected)
+		if err := scanner.Run(query, bytes.NewReader(data), int64(len(data)), result); err != nil {
+			t.Errorf("%s: unexpected error: %v", src, err)
+		}
+		if result.String() != expected.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", src, result.String(), expected.String())
+		}
+	}
+}
+
+func TestParallelErrors(t *testing.T) {
+	data := strings.Repeat(`{"name":"a"}`+"\r\n", 50) + "{broken\n" + strings.Repeat(`{"name":"b"}`+"\n", 50)
+	scanner := ParallelScanner{Workers: 4, ChunkSize: 64}
+
+	err := scanner.Run(MustCompile(""), strings.NewReader(data), int64(len(data)), ioutil.Discard)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 51: ") {
+		t.Errorf("expected error on line 51, got %v", err)
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ParallelSearch(ioutil.Discard, androidAndMSIE)
+	}
+}
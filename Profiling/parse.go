@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	jlexer "github.com/mailru/easyjson/jlexer"
+)
+
+// ParsePolicy - what a search does with lines that aren't users
+type ParsePolicy int
+
+const (
+	// FailFast - stops at the first bad line with its *ParseError
+	FailFast ParsePolicy = iota
+	// Skip - goes on as if the bad lines were not there, their numbers are kept
+	Skip
+	// Collect - Skip that reports the bad lines in the result
+	Collect
+)
+
+// ParsePolicies - policies by name, for flags
+var ParsePolicies = map[string]ParsePolicy{
+	"fail":    FailFast,
+	"skip":    Skip,
+	"collect": Collect,
+}
+
+// ParseError - a line that isn't a user
+type ParseError struct {
+	// Line - the number of the line, from 1
+	Line int `json:"line"`
+	// Start - the position of the line in the input
+	Start int64 `json:"start"`
+	// Offset - the position in the line parsing stopped at, -1 if unknown
+	Offset int   `json:"offset"`
+	Err    error `json:"-"`
+}
+
+// newParseError - the error of data, the line at start
+func newParseError(line int, start int64, data []byte, err error) *ParseError {
+	offset := -1
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the line is cut short
+		offset = len(data)
+	}
+	switch err := err.(type) {
+	case *jlexer.LexerError:
+		offset = err.Offset
+	case *json.SyntaxError:
+		offset = int(err.Offset)
+	case *json.UnmarshalTypeError:
+		offset = int(err.Offset)
+	}
+	return &ParseError{Line: line, Start: start, Offset: offset, Err: err}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// MarshalJSON - the error goes as a string
+func (e *ParseError) MarshalJSON() ([]byte, error) {
+	type plain ParseError
+	return json.Marshal(struct {
+		*plain
+		Error string `json:"error"`
+	}{(*plain)(e), e.Err.Error()})
+}
+
+// UnmarshalJSON - the error comes back as a string
+func (e *ParseError) UnmarshalJSON(data []byte) error {
+	type plain ParseError
+	v := struct {
+		*plain
+		Error string `json:"error"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	e.Err = fmt.Errorf("%s", v.Error)
+	return nil
+}
+
+// lineReader - lines of any length with their positions, ReadLine returns
+// the long ones in parts
+type lineReader struct {
+	reader *bufio.Reader
+	buf    []byte
+	// pos - the position of the next line
+	pos int64
+}
+
+func newLineReader(in io.Reader) *lineReader {
+	return &lineReader{reader: bufio.NewReader(in)}
+}
+
+// next - the line without "\n" or "\r\n" and its position, valid till the
+// next call; io.EOF after the last one
+func (r *lineReader) next() ([]byte, int64, error) {
+	start := r.pos
+	line, err := r.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		r.buf = append(r.buf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = r.reader.ReadSlice('\n')
+			r.buf = append(r.buf, line...)
+		}
+		line = r.buf
+	}
+	r.pos += int64(len(line))
+	if err == io.EOF && len(line) > 0 {
+		// the last line has no newline
+		err = nil
+	}
+	if err != nil {
+		return nil, start, err
+	}
+
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+	}
+	return line, start, nil
+}
+
+// redactedError - the reason of a parse error without the data it was
+// found in: lexer errors quote the rest of the line, strconv ones the number
+func redactedError(err error) error {
+	reason := err.Error()
+	if lexerErr, ok := err.(*jlexer.LexerError); ok {
+		reason = lexerErr.Reason
+	}
+	if strings.HasPrefix(reason, "strconv.") {
+		reason = reason[strings.LastIndex(reason, ": ")+2:]
+	}
+	if i := strings.IndexAny(reason, "'\"`"); i != -1 {
+		reason = strings.TrimSpace(reason[:i])
+	}
+	return errors.New(reason)
+}
+
+// badLine - what the policy makes of the bad line: the error to stop
+// with, or nil to go on
+func (p ParsePolicy) badLine(err *ParseError, bad *[]*ParseError) error {
+	switch p {
+	case Skip:
+		return nil
+	case Collect:
+		*bad = append(*bad, err)
+		return nil
+	}
+	return err
+}
+
+// writeBadLines - the bad lines after the users with the positions parsing
+// stopped at, nothing if there are none
+func writeBadLines(out io.Writer, bad []*ParseError) error {
+	if len(bad) == 0 {
+		return nil
+	}
+	buf := []byte(fmt.Sprintf("\nBad lines %d\n", len(bad)))
+	for _, err := range bad {
+		buf = append(buf, fmt.Sprintf("line %d, offset %d: %v\n", err.Line, err.Offset, err.Err)...)
+	}
+	_, err := out.Write(buf)
+	return err
+}
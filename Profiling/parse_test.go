@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// badFixture - resultFixture with bad lines 2 and 5, line 4 is longer
+// than the buffer of bufio.Reader
+var badFixture = strings.Join([]string{
+	`{"browsers":["Android 4","MSIE 8"],"name":"A","email":"a@mail.ru"}`,
+	`{"browsers":["MSIE 9"],"name":`,
+	`{"browsers":["Android 5","Opera"],"name":"C","email":"c@mail.ru"}`,
+	`{"browsers":["Android 6","MSIE 10"],"name":"` + strings.Repeat("D", 10000) + `","email":"d@mail.ru"}`,
+	`oops`,
+	`{"browsers":["MSIE 7","Android 2"],"name":"E","email":"e@mail.ru"}`,
+}, "\n")
+
+func TestParsePolicy(t *testing.T) {
+	lines := []int{}
+	starts := []int64{}
+	for i, start := 0, 0; i < 6; i++ {
+		end := start + strings.IndexByte(badFixture[start:]+"\n", '\n')
+		if i == 1 || i == 4 {
+			lines = append(lines, i+1)
+			starts = append(starts, int64(start))
+		}
+		start = end + 1
+	}
+
+	cases := []struct {
+		Policy ParsePolicy
+		Users  []int
+		Bad    []int
+	}{
+		{FailFast, nil, nil},
+		{Skip, []int{0, 3, 5}, nil},
+		{Collect, []int{0, 3, 5}, lines},
+	}
+	for idx, item := range cases {
+		for _, find := range []func(in io.Reader, policy ParsePolicy) (*Result, error){SlowSearch, FastSearch} {
+			result, err := find(strings.NewReader(badFixture), item.Policy)
+
+			if item.Policy == FailFast {
+				parseErr, ok := err.(*ParseError)
+				if !ok || parseErr.Line != 2 || parseErr.Start != starts[0] || parseErr.Offset < 0 {
+					t.Errorf("[%d] expected error on line 2, got %#v", idx, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("[%d] unexpected error: %v", idx, err)
+			}
+
+			users, bad := []int{}, []int{}
+			for _, user := range result.Users {
+				users = append(users, user.Line)
+			}
+			for i, err := range result.BadLines {
+				bad = append(bad, err.Line)
+				if err.Start != starts[i] || err.Offset < 0 {
+					t.Errorf("[%d] bad position of %v: %d, %d", idx, err, err.Start, err.Offset)
+				}
+			}
+			if item.Bad == nil {
+				item.Bad = []int{}
+			}
+			if !reflect.DeepEqual(users, item.Users) || !reflect.DeepEqual(bad, item.Bad) {
+				t.Errorf("[%d] results not match\nGot:\n%v %v\nExpected:\n%v %v", idx, users, bad, item.Users, item.Bad)
+			}
+		}
+	}
+}
+
+func TestParsePolicyRun(t *testing.T) {
+	query := MustCompile(`SELECT name WHERE browsers ~ "Android" AND browsers ~ "MSIE"`)
+	query.Policy = Collect
+
+	expected := new(bytes.Buffer)
+	if err := query.Run(strings.NewReader(badFixture), expected); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(expected.String(), "\nBad lines 2\nline 2, offset 30: EOF\n") {
+		t.Errorf("no bad lines in\n%s", expected.String())
+	}
+
+	result, err := query.Find(strings.NewReader(badFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := new(bytes.Buffer)
+	result.WriteText(text)
+
+	cases := []ParallelScanner{{Workers: 1, ChunkSize: 1}, {Workers: 4, ChunkSize: 100}, {Workers: 2, ChunkSize: 1 << 20}}
+	for idx, scanner := range cases {
+		out := new(bytes.Buffer)
+		if err := scanner.Run(query, strings.NewReader(badFixture), int64(len(badFixture)), out); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		if out.String() != expected.String() || text.String() != expected.String() {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), expected.String())
+		}
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	cases := []struct {
+		In    string
+		Lines []string
+	}{
+		{"", []string{}},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a"}},
+		{"a\r\nb\n\nc", []string{"a", "b", "", "c"}},
+		{long + "\r\n" + long + long + "\n" + long, []string{long, long + long, long}},
+	}
+	for idx, item := range cases {
+		reader := newLineReader(strings.NewReader(item.In))
+		lines := []string{}
+		pos := int64(0)
+		for {
+			line, start, err := reader.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if start != pos || !strings.HasPrefix(item.In[start:], string(line)) {
+				t.Errorf("[%d] bad position %d of %.10q", idx, start, line)
+			}
+			pos = start + int64(strings.IndexByte(item.In[start:]+"\n", '\n')) + 1
+			lines = append(lines, string(line))
+		}
+		if !reflect.DeepEqual(lines, item.Lines) {
+			t.Errorf("[%d] results not match\nGot:\n%.40q\nExpected:\n%.40q", idx, lines, item.Lines)
+		}
+	}
+}
+
+func TestSearchCommandPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.txt")
+	if err := ioutil.WriteFile(path, []byte(badFixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Args     []string
+		Expected string
+	}{
+		{[]string{"-format", "csv", "-bad", "skip"}, "line,name\n0,A\n3," + strings.Repeat("D", 10000) + "\n5,E\n"},
+		{[]string{"-format", "json", "-bad", "collect"}, `"bad_lines": [`},
+	}
+	for idx, item := range cases {
+		out := new(bytes.Buffer)
+		args := append(append([]string{"search", "-file", path}, item.Args...), `SELECT name WHERE browsers ~ "MSIE"`)
+		if err := run(args, out); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		if !strings.Contains(out.String(), item.Expected) {
+			t.Errorf("[%d] results not match\nGot:\n%.200s\nExpected:\n%.200s", idx, out.String(), item.Expected)
+		}
+	}
+
+	if err := run([]string{"search", "-file", path}, new(bytes.Buffer)); err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+	if err := run([]string{"search", "-file", path, "-bad", "ignore"}, new(bytes.Buffer)); err == nil {
+		t.Errorf("expected error for an unknown policy")
+	}
+}
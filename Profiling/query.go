@@ -0,0 +1,514 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Query - compiled query over users, like
+//
+//	SELECT name, country WHERE browsers ~ "Android" AND (country = "Peru" OR NOT job ~ "Manager")
+//
+// ~ is "contains", = is "equals", != and !~ are their negations. For browsers a
+// condition holds if any of them matches, a negated one - if none of them does.
+// Without SELECT the fields are name and email, without WHERE all users match
+type Query struct {
+	Fields []string
+	// Policy - what to do with lines that aren't users
+	Policy ParsePolicy
+	// Redact - what to print instead of the values of the fields
+	Redact Redaction
+
+	match predicate
+	// browsers - positive conditions on browsers, the browsers they match are counted
+	browsers []condition
+	// candidates - lines of an index the matching users are among, nil if any line
+	candidates lookup
+}
+
+type predicate func(user *User) bool
+
+// lookup - lines of the index a part of the query may hold for
+type lookup func(idx *Index) []uint32
+
+// expr - a parsed part of the query
+type expr struct {
+	match  predicate
+	lookup lookup
+}
+
+type condition struct {
+	op    string
+	value string
+}
+
+// userFields - string fields of User by name
+var userFields = map[string]func(user *User) string{
+	"company": func(user *User) string { return user.Company },
+	"country": func(user *User) string { return user.Country },
+	"email":   func(user *User) string { return user.Email },
+	"job":     func(user *User) string { return user.Job },
+	"name":    func(user *User) string { return user.Name },
+	"phone":   func(user *User) string { return user.Phone },
+}
+
+// reset - the user for the next line, the browsers slice is kept for reuse
+func (user *User) reset() {
+	*user = User{Browsers: user.Browsers[:0]}
+}
+
+// MustCompile - Compile that panics on errors
+func MustCompile(src string) *Query {
+	query, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return query
+}
+
+// Compile - parses the query
+func Compile(src string) (*Query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, query: &Query{Fields: []string{"name", "email"}}}
+
+	if p.keyword("SELECT") {
+		if p.query.Fields, err = p.fields(); err != nil {
+			return nil, err
+		}
+		if !p.keyword("WHERE") && p.peek().kind != tokEOF {
+			return nil, p.unexpected()
+		}
+	}
+
+	p.query.match = func(*User) bool { return true }
+	if p.peek().kind != tokEOF {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.query.match, p.query.candidates = e.match, e.lookup
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	return p.query, nil
+}
+
+// Match - the user fits the query
+func (q *Query) Match(user *User) bool {
+	return q.match(user)
+}
+
+// countBrowser - the browser is one of those the query looks for
+func (q *Query) countBrowser(browser string) bool {
+	for _, cond := range q.browsers {
+		if cond.holds(browser) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup - lines with browsers that have the value in them, nil if
+// the value is too short for the index
+func (cond condition) lookup() lookup {
+	if len(cond.value) < gramSize {
+		return nil
+	}
+	return func(idx *Index) []uint32 { return idx.lookup(cond.value) }
+}
+
+func (cond condition) holds(value string) bool {
+	switch cond.op {
+	case "~", "!~":
+		return strings.Contains(value, cond.value)
+	}
+	return value == cond.value
+}
+
+// appendFields - selected fields of the user separated by spaces
+func (q *Query) appendFields(buf []byte, user *User) []byte {
+	for i, field := range q.Fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		if redact := q.Redact[field]; redact != nil {
+			buf = appendField(buf, field, redact(fieldValue(field, user)))
+			continue
+		}
+		if field == "browsers" {
+			for j, browser := range user.Browsers {
+				if j > 0 {
+					buf = append(buf, "; "...)
+				}
+				buf = append(buf, browser...)
+			}
+			continue
+		}
+		buf = appendField(buf, field, userFields[field](user))
+	}
+	return buf
+}
+
+// appendField - the value as it's printed: email with " [at] " in <>,
+// the rest as it is
+func appendField(buf []byte, field, value string) []byte {
+	if field != "email" {
+		return append(buf, value...)
+	}
+	buf = append(buf, '<')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '@' {
+			buf = append(buf, " [at] "...)
+		} else {
+			buf = append(buf, value[i])
+		}
+	}
+	return append(buf, '>')
+}
+
+// fieldValue - the field of the user, browsers separated by "; "
+func fieldValue(field string, user *User) string {
+	if field == "browsers" {
+		return strings.Join(user.Browsers, "; ")
+	}
+	return userFields[field](user)
+}
+
+// value - fieldValue as the query prints it
+func (q *Query) value(field string, user *User) string {
+	if redact := q.Redact[field]; redact != nil {
+		return redact(fieldValue(field, user))
+	}
+	return fieldValue(field, user)
+}
+
+// badLine - Policy.badLine, with any redaction the error tells nothing of
+// the data of the line
+func (q *Query) badLine(err *ParseError, bad *[]*ParseError) error {
+	if len(q.Redact) > 0 {
+		err.Err = redactedError(err.Err)
+	}
+	return q.Policy.badLine(err, bad)
+}
+
+// Run - FastSearch with the query: users of in that match it go to out
+// as "[line] fields", then the number of unique browsers the query looks for
+func (q *Query) Run(in io.Reader, out io.Writer) error {
+	buf := []byte{}
+	browsers := 0
+
+	fmt.Fprintln(out, "found users:")
+
+	bad, err := q.scan(in, func(i int, user *User) error {
+		buf = append(buf[:0], '[')
+		buf = strconv.AppendInt(buf, int64(i), 10)
+		buf = append(buf, "] "...)
+		buf = q.appendFields(buf, user)
+		buf = append(buf, '\n')
+		_, err := out.Write(buf)
+		return err
+	}, func(string) { browsers++ })
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\nTotal unique browsers", browsers)
+	return writeBadLines(out, bad)
+}
+
+// scan - calls found for the users of in that match the query with their
+// line index, seen for every browser the query looks for the first time it's
+// there; the bad lines are collected if the policy says so
+func (q *Query) scan(in io.Reader, found func(i int, user *User) error, seen func(browser string)) ([]*ParseError, error) {
+	seenBrowsers := map[string]bool{}
+	reader := newLineReader(in)
+	user := &User{}
+	var bad []*ParseError
+
+	for i := 0; ; i++ {
+		line, start, err := reader.next()
+		if err == io.EOF {
+			return bad, nil
+		}
+		if err != nil {
+			return bad, err
+		}
+
+		user.reset()
+		if err := user.UnmarshalJSON(line); err != nil {
+			if err := q.badLine(newParseError(i+1, start, line, err), &bad); err != nil {
+				return bad, err
+			}
+			continue
+		}
+
+		if len(q.browsers) > 0 {
+			for _, browser := range user.Browsers {
+				if !seenBrowsers[browser] && q.countBrowser(browser) {
+					seenBrowsers[browser] = true
+					seen(browser)
+				}
+			}
+		}
+
+		if q.match(user) {
+			if err := found(i, user); err != nil {
+				return bad, err
+			}
+		}
+	}
+}
+
+// Search - runs the query over the users file
+func Search(out io.Writer, query *Query) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return query.Run(file, out)
+}
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '=' || c == '~':
+			tokens = append(tokens, token{tokOp, string(c), i})
+			i++
+		case c == '!' && i+1 < len(src) && (src[i+1] == '=' || src[i+1] == '~'):
+			tokens = append(tokens, token{tokOp, src[i : i+2], i})
+			i += 2
+		case c == '"':
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			value, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d: %v", i, err)
+			}
+			tokens = append(tokens, token{tokString, value, i})
+			i = j + 1
+		case isLetter(c):
+			j := i
+			for j < len(src) && isLetter(src[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, src[i:j], i})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of query", len(src)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+type parser struct {
+	tokens []token
+	query  *Query
+}
+
+func (p *parser) peek() token {
+	return p.tokens[0]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[0]
+	if tok.kind != tokEOF {
+		p.tokens = p.tokens[1:]
+	}
+	return tok
+}
+
+func (p *parser) unexpected() error {
+	tok := p.peek()
+	return fmt.Errorf("unexpected %s at %d", tok.text, tok.pos)
+}
+
+// keyword - skips the keyword if it's the next token
+func (p *parser) keyword(word string) bool {
+	if tok := p.peek(); tok.kind == tokIdent && strings.EqualFold(tok.text, word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) field() (string, error) {
+	tok := p.next()
+	name := strings.ToLower(tok.text)
+	if _, ok := userFields[name]; tok.kind != tokIdent || (!ok && name != "browsers") {
+		return "", fmt.Errorf("unknown field %s at %d", tok.text, tok.pos)
+	}
+	return name, nil
+}
+
+func (p *parser) fields() ([]string, error) {
+	fields := []string{}
+	for {
+		field, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+		if p.peek().kind != tokComma {
+			return fields, nil
+		}
+		p.next()
+	}
+}
+
+// or - the lines of any side, unless one of them may be any line
+func (p *parser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return expr{}, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return expr{}, err
+		}
+		a, b := left, right
+		left = expr{match: func(user *User) bool { return a.match(user) || b.match(user) }}
+		if a.lookup != nil && b.lookup != nil {
+			left.lookup = func(idx *Index) []uint32 { return union(a.lookup(idx), b.lookup(idx)) }
+		}
+	}
+	return left, nil
+}
+
+// and - the lines of both sides
+func (p *parser) and() (expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return expr{}, err
+	}
+	for p.keyword("AND") {
+		right, err := p.not()
+		if err != nil {
+			return expr{}, err
+		}
+		a, b := left, right
+		left = expr{match: func(user *User) bool { return a.match(user) && b.match(user) }}
+		switch {
+		case a.lookup == nil:
+			left.lookup = b.lookup
+		case b.lookup == nil:
+			left.lookup = a.lookup
+		default:
+			left.lookup = func(idx *Index) []uint32 { return intersect(a.lookup(idx), b.lookup(idx)) }
+		}
+	}
+	return left, nil
+}
+
+// not - any line, the index only knows where substrings are
+func (p *parser) not() (expr, error) {
+	if p.keyword("NOT") {
+		inner, err := p.not()
+		if err != nil {
+			return expr{}, err
+		}
+		return expr{match: func(user *User) bool { return !inner.match(user) }}, nil
+	}
+
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return expr{}, err
+		}
+		if p.peek().kind != tokRParen {
+			return expr{}, p.unexpected()
+		}
+		p.next()
+		return inner, nil
+	}
+
+	return p.condition()
+}
+
+func (p *parser) condition() (expr, error) {
+	field, err := p.field()
+	if err != nil {
+		return expr{}, err
+	}
+	op := p.next()
+	if op.kind != tokOp {
+		return expr{}, fmt.Errorf("expected operator at %d, got %s", op.pos, op.text)
+	}
+	value := p.next()
+	if value.kind != tokString {
+		return expr{}, fmt.Errorf("expected string at %d, got %s", value.pos, value.text)
+	}
+
+	cond := condition{op.text, value.text}
+	negated := op.text[0] == '!'
+
+	if field == "browsers" {
+		e := expr{match: func(user *User) bool {
+			for _, browser := range user.Browsers {
+				if cond.holds(browser) {
+					return !negated
+				}
+			}
+			return negated
+		}}
+		if !negated {
+			p.query.browsers = append(p.query.browsers, cond)
+			e.lookup = cond.lookup()
+		}
+		return e, nil
+	}
+
+	get := userFields[field]
+	return expr{match: func(user *User) bool {
+		return cond.holds(get(user)) != negated
+	}}, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	user := &User{
+		Browsers: []string{"Mozilla/5.0 (Linux; Android 4.4)", "Opera/9.80 (Windows NT 6.1)"},
+		Company:  "Flashpoint",
+		Country:  "Peru",
+		Email:    "JonathanMorris@Muxo.edu",
+		Job:      "Programmer Analyst",
+		Name:     "Sharon Crawford",
+		Phone:    "176-88-49",
+	}
+	cases := []struct {
+		Query    string
+		Expected bool
+	}{
+		{``, true},
+		{`browsers ~ "Android"`, true},
+		{`browsers ~ "Android" AND browsers ~ "MSIE"`, false},
+		{`browsers ~ "Android" AND country = "Peru"`, true},
+		{`browsers = "Opera/9.80 (Windows NT 6.1)"`, true},
+		{`browsers !~ "MSIE" and job ~ "Analyst"`, true},
+		{`browsers != "Opera/9.80 (Windows NT 6.1)"`, false},
+		{`country != "Peru" OR name ~ "Sharon"`, true},
+		{`NOT (company = "Flashpoint" OR phone ~ "000")`, false},
+		{`not not email ~ "@Muxo"`, true},
+		{`name = "sharon crawford"`, false},
+		{`SELECT name, phone WHERE job ~ "\"quoted\""`, false},
+		{`SELECT name`, true},
+	}
+
+	for idx, item := range cases {
+		query, err := Compile(item.Query)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if query.Match(user) != item.Expected {
+			t.Errorf("[%d] %s: expected %v", idx, item.Query, item.Expected)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for idx, src := range []string{
+		`browsers`,
+		`browsers ~`,
+		`browsers ~ Android`,
+		`age = "42"`,
+		`name = "unterminated`,
+		`(name = "a"`,
+		`name = "a" name = "b"`,
+		`name = "a" AND`,
+		`SELECT name email`,
+		`SELECT WHERE name = "a"`,
+		`name == "a"`,
+	} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("[%d] %s: expected error here", idx, src)
+		}
+	}
+}
+
+func TestQueryRun(t *testing.T) {
+	in := strings.Join([]string{
+		`{"browsers":["Android 4","MSIE 8"],"country":"Peru","email":"a@mail.ru","name":"A","phone":"1"}`,
+		`{"browsers":["MSIE 9"],"country":"Peru","email":"b@mail.ru","name":"B","phone":"2"}`,
+		`{"browsers":["Android 5","Opera"],"country":"Chile","email":"c@mail.ru","name":"C","phone":"3"}`,
+	}, "\n")
+	cases := []struct {
+		Query    string
+		Expected string
+	}{
+		{
+			`browsers ~ "Android" AND browsers ~ "MSIE"`,
+			"found users:\n[0] A <a [at] mail.ru>\n\nTotal unique browsers 4\n",
+		},
+		{
+			`SELECT phone, name, country, browsers WHERE country = "Peru"`,
+			"found users:\n[0] 1 A Peru Android 4; MSIE 8\n[1] 2 B Peru MSIE 9\n\nTotal unique browsers 0\n",
+		},
+	}
+
+	for idx, item := range cases {
+		out := &bytes.Buffer{}
+		if err := MustCompile(item.Query).Run(strings.NewReader(in), out); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if out.String() != item.Expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), item.Expected)
+		}
+	}
+
+	if err := MustCompile("").Run(strings.NewReader("{broken"), &bytes.Buffer{}); err == nil {
+		t.Errorf("expected error for broken json")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Redactor - what is printed instead of a value of a field
+type Redactor func(value string) string
+
+// Redaction - redactors by output field, the fields without them are
+// printed as they are
+type Redaction map[string]Redactor
+
+// Redactors - makers of redactors by style; key is the secret of token,
+// the same value with the same key always gets the same token
+var Redactors = map[string]func(key []byte) (Redactor, error){
+	"partial":  static(partialEmail),
+	"hash":     static(hashValue),
+	"domain":   static(emailDomain),
+	"phone":    static(maskPhone),
+	"initials": static(initials),
+	"token": func(key []byte) (Redactor, error) {
+		if len(key) == 0 {
+			return nil, fmt.Errorf("token needs a key")
+		}
+		return func(value string) string {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(value))
+			return "tok_" + hex.EncodeToString(mac.Sum(nil)[:8])
+		}, nil
+	},
+}
+
+func static(r Redactor) func(key []byte) (Redactor, error) {
+	return func([]byte) (Redactor, error) { return r, nil }
+}
+
+// ParseRedaction - the redaction of a spec like "email=partial,name=initials"
+func ParseRedaction(spec string, key []byte) (Redaction, error) {
+	redaction := Redaction{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		eq := strings.IndexByte(part, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("expected field=style, got %q", part)
+		}
+		field, style := part[:eq], part[eq+1:]
+		if _, ok := userFields[field]; !ok && field != "browsers" {
+			return nil, fmt.Errorf("unknown field %s", field)
+		}
+		makeRedactor, ok := Redactors[style]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction %s", style)
+		}
+		r, err := makeRedactor(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s=%s: %v", field, style, err)
+		}
+		redaction[field] = r
+	}
+	return redaction, nil
+}
+
+// partialEmail - the first letter of the mailbox and the domain:
+// JonathanMorris@Muxo.edu is J***@Muxo.edu
+func partialEmail(value string) string {
+	at := strings.LastIndexByte(value, '@')
+	local, domain := value, ""
+	if at != -1 {
+		local, domain = value[:at], value[at:]
+	}
+	if local == "" {
+		return "***" + domain
+	}
+	_, size := utf8.DecodeRuneInString(local)
+	return local[:size] + "***" + domain
+}
+
+// emailDomain - only the domain: JonathanMorris@Muxo.edu is *@Muxo.edu
+func emailDomain(value string) string {
+	at := strings.LastIndexByte(value, '@')
+	if at == -1 {
+		return "*"
+	}
+	return "*" + value[at:]
+}
+
+// hashValue - hex of the first bytes of SHA-256 of the value; anyone can
+// hash a guessed value and compare, token can't be guessed without the key
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// maskPhone - digits but the last two are stars: 176-88-49 is ***-**-49
+func maskPhone(value string) string {
+	digits := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] >= '0' && value[i] <= '9' {
+			digits++
+		}
+	}
+	buf := []byte(value)
+	for i := range buf {
+		if buf[i] >= '0' && buf[i] <= '9' && digits > 2 {
+			buf[i] = '*'
+			digits--
+		}
+	}
+	return string(buf)
+}
+
+// initials - the first letters of the words: Jonathan Morris is J. M.
+func initials(value string) string {
+	words := strings.FieldsFunc(value, func(r rune) bool { return !unicode.IsLetter(r) })
+	for i, word := range words {
+		r, _ := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(r)) + "."
+	}
+	return strings.Join(words, " ")
+}
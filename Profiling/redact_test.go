@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactors(t *testing.T) {
+	key := []byte("secret")
+	cases := []struct {
+		Style    string
+		Value    string
+		Expected string
+	}{
+		{"partial", "JonathanMorris@Muxo.edu", "J***@Muxo.edu"},
+		{"partial", "Élise@Muxo.edu", "É***@Muxo.edu"},
+		{"partial", "@Muxo.edu", "***@Muxo.edu"},
+		{"partial", "nobody", "n***"},
+		{"domain", "eum_rerum_explicabo@Topiczoom.info", "*@Topiczoom.info"},
+		{"domain", "nobody", "*"},
+		{"hash", "yKing@Leexo.net", "cb8fc168c7c6c643"},
+		{"phone", "176-88-49", "***-**-49"},
+		{"phone", "1-234-567-89-80", "*-***-***-**-80"},
+		{"phone", "5", "5"},
+		{"initials", "Jonathan Morris", "J. M."},
+		{"initials", "anne-marie o'neil", "A. M. O. N."},
+		{"initials", "", ""},
+		{"token", "yKing@Leexo.net", ""},
+	}
+	for idx, item := range cases {
+		redact, err := Redactors[item.Style](key)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		got := redact(item.Value)
+		if item.Style == "token" {
+			if !strings.HasPrefix(got, "tok_") || len(got) != 20 || got != redact(item.Value) {
+				t.Errorf("[%d] bad token %q", idx, got)
+			}
+			other, _ := Redactors["token"]([]byte("other"))
+			if other(item.Value) == got || redact("yking@Leexo.net") == got {
+				t.Errorf("[%d] token doesn't depend on the key and the value", idx)
+			}
+			continue
+		}
+		if got != item.Expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, got, item.Expected)
+		}
+	}
+}
+
+func TestParseRedaction(t *testing.T) {
+	cases := []struct {
+		Spec   string
+		Key    string
+		Fields int
+		Err    string
+	}{
+		{"", "", 0, ""},
+		{"email=partial, name=initials,", "", 2, ""},
+		{"phone=phone,company=token", "k", 2, ""},
+		{"email", "", 0, "expected field=style"},
+		{"age=hash", "", 0, "unknown field age"},
+		{"email=rot13", "", 0, "unknown redaction rot13"},
+		{"email=token", "", 0, "email=token: token needs a key"},
+	}
+	for idx, item := range cases {
+		redaction, err := ParseRedaction(item.Spec, []byte(item.Key))
+		if item.Err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), item.Err) {
+				t.Errorf("[%d] expected error %q, got %v", idx, item.Err, err)
+			}
+			continue
+		}
+		if err != nil || len(redaction) != item.Fields {
+			t.Errorf("[%d] results not match\nGot:\n%v %v\nExpected:\n%v", idx, len(redaction), err, item.Fields)
+		}
+	}
+}
+
+func TestRedactedSearch(t *testing.T) {
+	query := MustCompile(`SELECT name, email, phone, browsers WHERE country = "Peru"`)
+	var err error
+	if query.Redact, err = ParseRedaction("name=initials,email=domain,phone=phone,browsers=hash", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "found users:\n" +
+		"[0] A. J. <* [at] mail.ru> 1 " + hashValue("Android 4; MSIE 8") + "\n" +
+		"[1] B. <* [at] mail.ru> 2 " + hashValue("MSIE 9") + "\n" +
+		"\nTotal unique browsers 0\n"
+
+	out := new(bytes.Buffer)
+	if err := query.Run(strings.NewReader(resultFixture), out); err != nil {
+		t.Fatal(err)
+	}
+	result, err := query.Find(strings.NewReader(resultFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := new(bytes.Buffer)
+	result.WriteText(text)
+	parallel := new(bytes.Buffer)
+	scanner := ParallelScanner{Workers: 2, ChunkSize: 16}
+	if err := scanner.Run(query, strings.NewReader(resultFixture), int64(len(resultFixture)), parallel); err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, got := range []string{out.String(), text.String(), parallel.String()} {
+		if got != expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, got, expected)
+		}
+	}
+	if strings.Contains(result.Users[0].Values["email"], "a@") {
+		t.Errorf("email isn't redacted: %v", result.Users[0].Values)
+	}
+}
+
+func TestSearchCommandRedact(t *testing.T) {
+	out := new(bytes.Buffer)
+	args := []string{"search", "-format", "csv", "-redact", "email=partial,name=initials", `SELECT name, email WHERE email = "JonathanMorris@Muxo.edu"`}
+	if err := run(args, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "0,S. C.,J***@Muxo.edu\n") {
+		t.Errorf("results not match\nGot:\n%v", out.String())
+	}
+
+	args = []string{"search", "-format", "json", "-redact", "browsers=hash", `SELECT browsers WHERE browsers ~ "MSIE"`}
+	out.Reset()
+	if err := run(args, out); err != nil {
+		t.Fatal(err)
+	}
+	result := &Result{}
+	if err := json.Unmarshal(out.Bytes(), result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Browsers) == 0 || len(result.Users) == 0 {
+		t.Fatalf("nothing found:\n%.200s", out.String())
+	}
+	for _, browser := range result.Browsers {
+		if len(browser) != 16 || strings.Contains(out.String(), "MSIE") {
+			t.Fatalf("browsers aren't redacted:\n%.200s", out.String())
+		}
+	}
+
+	t.Setenv(tokenKeyEnv, "")
+	if err := run([]string{"search", "-redact", "email=token", "SELECT email"}, out); err == nil {
+		t.Errorf("expected error for a token without a key")
+	}
+}
+
+func TestRedactBadLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.txt")
+	data := strings.Join([]string{
+		`{"browsers":["MSIE 8"],"name":"Jonathan Morris","email":"jm@mail.ru","phone":"176-88-49"}`,
+		`{"browsers":["MSIE 9"],"email":secret@mail.ru,"name":"Secret Person","phone":"123-45-67"}`,
+		`{"browsers":["MSIE 7"],"name":"Secret Person","email":"secret@mail.ru","phone":"123-45-67"`,
+	}, "\n")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	query := `SELECT name, email, phone WHERE browsers ~ "MSIE"`
+	cases := []struct {
+		Args     []string
+		Expected string
+	}{
+		{[]string{"-format", "text"}, "\nBad lines 2\nline 2, offset 31: syntax error\n"},
+		{[]string{"-format", "json"}, `"error": "syntax error"`},
+	}
+	for idx, item := range cases {
+		args := append([]string{"search", "-file", path, "-bad", "collect"}, item.Args...)
+		out := new(bytes.Buffer)
+		if err := run(append(args, query), out); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		// without redaction the error shows the rest of the line
+		if !strings.Contains(out.String(), "secret@") {
+			t.Errorf("[%d] no data in the errors of\n%s", idx, out.String())
+		}
+
+		out.Reset()
+		args = append(args, "-redact", "email=hash,name=initials,phone=phone", query)
+		if err := run(args, out); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		for _, value := range []string{"Secret", "secret@", "123-45-67", "Jonathan", "jm@mail.ru"} {
+			if strings.Contains(out.String(), value) {
+				t.Errorf("[%d] %s is not redacted in\n%s", idx, value, out.String())
+			}
+		}
+		if !strings.Contains(out.String(), item.Expected) {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), item.Expected)
+		}
+	}
+}
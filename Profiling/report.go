@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Report - browsers entries of users by family for every value of a
+// user field, like country or company
+type Report struct {
+	By string `json:"by"`
+	// Families - the columns, most used first
+	Families []string    `json:"families"`
+	Rows     []ReportRow `json:"rows"`
+	// BadLines - lines that aren't users, with the Collect policy
+	BadLines []*ParseError `json:"bad_lines,omitempty"`
+}
+
+// ReportRow - browsers entries of users with the Key in the field by family
+type ReportRow struct {
+	Key    string         `json:"key"`
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+}
+
+// ReportFormats - renderers of the report by name
+var ReportFormats = map[string]func(r *Report, out io.Writer) error{
+	"text": (*Report).WriteText,
+	"csv":  (*Report).WriteCSV,
+	"json": (*Report).WriteJSON,
+}
+
+// BuildReport - the report over users of in by the field; with top > 0 only
+// that many families get their columns, the rest go to Other. Lines that
+// aren't users are up to the policy
+func BuildReport(in io.Reader, by string, top int, policy ParsePolicy) (*Report, error) {
+	get, ok := userFields[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s", by)
+	}
+
+	rows := map[string]*ReportRow{}
+	totals := map[string]int{}
+	agents := map[string]string{}
+	reader := newLineReader(in)
+	user := &User{}
+	var bad []*ParseError
+
+	for i := 0; ; i++ {
+		line, start, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		user.reset()
+		if err := user.UnmarshalJSON(line); err != nil {
+			if err := policy.badLine(newParseError(i+1, start, line, err), &bad); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		key := get(user)
+		row := rows[key]
+		if row == nil {
+			row = &ReportRow{Key: key, Counts: map[string]int{}}
+			rows[key] = row
+		}
+		for _, browser := range user.Browsers {
+			family, ok := agents[browser]
+			if !ok {
+				family = ParseUserAgent(browser).Family
+				agents[browser] = family
+			}
+			row.Counts[family]++
+			row.Total++
+			totals[family]++
+		}
+	}
+
+	if families := byCount(totals); top > 0 && len(families) > top {
+		for _, family := range families[top:] {
+			if family == Other {
+				continue
+			}
+			for _, row := range rows {
+				if n, ok := row.Counts[family]; ok {
+					delete(row.Counts, family)
+					row.Counts[Other] += n
+				}
+			}
+			totals[Other] += totals[family]
+			delete(totals, family)
+		}
+	}
+
+	report := &Report{By: by, Families: byCount(totals), BadLines: bad}
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Key < b.Key
+	})
+	return report, nil
+}
+
+// byCount - the keys, the greatest counts first
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// header - the column names: the field, families, total
+func (r *Report) header() []string {
+	return append(append([]string{r.By}, r.Families...), "total")
+}
+
+// record - the row in the order of header
+func (r *Report) record(row ReportRow) []string {
+	record := make([]string, 0, len(r.Families)+2)
+	record = append(record, row.Key)
+	for _, family := range r.Families {
+		record = append(record, strconv.Itoa(row.Counts[family]))
+	}
+	return append(record, strconv.Itoa(row.Total))
+}
+
+// WriteText - the report as an aligned table, then the bad lines
+func (r *Report) WriteText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	write := func(cells []string) {
+		for _, cell := range cells {
+			fmt.Fprint(w, cell, "\t")
+		}
+		fmt.Fprintln(w)
+	}
+	write(r.header())
+	for _, row := range r.Rows {
+		write(r.record(row))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return writeBadLines(out, r.BadLines)
+}
+
+// WriteCSV - the report as CSV with a header
+func (r *Report) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Write(r.header())
+	for _, row := range r.Rows {
+		w.Write(r.record(row))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteJSON - the report as an indented JSON object
+func (r *Report) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
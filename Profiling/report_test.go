@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reportFixture - the first lines of users.txt
+var reportFixture = `{"browsers":["Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.0 Safari/537.36","Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1","Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko"],"company":"Flashpoint","country":"Kenya","name":"Sharon Crawford"}
+{"browsers":["Mozilla/5.0 (X11; FreeBSD amd64) AppleWebKit/537.4 (KHTML like Gecko) Chrome/22.0.1229.79 Safari/537.4","Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0; Trident/5.0)","Mozilla/5.0 (iPad; U; CPU OS 4_3 like Mac OS X; en-us) AppleWebKit/533.17.9 (KHTML, like Gecko) Version/5.0.2 Mobile/8F190 Safari/6533.18.5"],"company":"Jatri","country":"Kenya","name":"Susan Ellis"}
+{"browsers":["Mozilla/5.0 (X11; U; Linux x86_64; en-US) AppleWebKit/534.15 (KHTML, like Gecko) Chrome/10.0.613.0 Safari/534.15","Mozilla/5.0 (X11; Linux i686; rv:49.0) Gecko/20100101 Firefox/49.0"],"company":"Dabtype","country":"Ecuador","name":"Joshua Fisher"}
+`
+
+func TestReport(t *testing.T) {
+	report, err := BuildReport(strings.NewReader(reportFixture), "country", 0, FailFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Report{
+		By:       "country",
+		Families: []string{"Chrome", "IE", "Firefox", "Firefox Mobile", "Safari"},
+		Rows: []ReportRow{
+			{"Kenya", map[string]int{"Chrome": 2, "Firefox Mobile": 1, "IE": 2, "Safari": 1}, 6},
+			{"Ecuador", map[string]int{"Chrome": 1, "Firefox": 1}, 2},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", report, expected)
+	}
+
+	cases := []struct {
+		Format   string
+		Expected string
+	}{
+		{"text", "" +
+			"  country  Chrome  IE  Firefox  Firefox Mobile  Safari  total\n" +
+			"    Kenya       2   2        0               1       1      6\n" +
+			"  Ecuador       1   0        1               0       0      2\n",
+		},
+		{"csv", "" +
+			"country,Chrome,IE,Firefox,Firefox Mobile,Safari,total\n" +
+			"Kenya,2,2,0,1,1,6\n" +
+			"Ecuador,1,0,1,0,0,2\n",
+		},
+	}
+	for idx, item := range cases {
+		out := new(bytes.Buffer)
+		if err := ReportFormats[item.Format](report, out); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if out.String() != item.Expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), item.Expected)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	report.WriteJSON(out)
+	decoded := &Report{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil || !reflect.DeepEqual(decoded, report) {
+		t.Errorf("json doesn't round trip: %v\n%s", err, out.String())
+	}
+}
+
+func TestReportTop(t *testing.T) {
+	report, err := BuildReport(strings.NewReader(reportFixture), "company", 2, FailFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Report{
+		By:       "company",
+		Families: []string{"Chrome", Other, "IE"},
+		Rows: []ReportRow{
+			{"Flashpoint", map[string]int{"Chrome": 1, "IE": 1, Other: 1}, 3},
+			{"Jatri", map[string]int{"Chrome": 1, "IE": 1, Other: 1}, 3},
+			{"Dabtype", map[string]int{"Chrome": 1, Other: 1}, 2},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", report, expected)
+	}
+}
+
+func TestReportUsers(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := BuildReport(file, "country", 5, FailFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Families) > 6 {
+		t.Errorf("too many families: %v", report.Families)
+	}
+	browsers := 0
+	for _, row := range report.Rows {
+		sum := 0
+		for _, n := range row.Counts {
+			sum += n
+		}
+		if sum != row.Total {
+			t.Errorf("%s: counts add up to %d, total is %d", row.Key, sum, row.Total)
+		}
+		browsers += row.Total
+	}
+	// every user of users.txt has 4 browsers
+	if browsers != 4*1000 {
+		t.Errorf("%d browsers counted", browsers)
+	}
+
+	if _, err := BuildReport(strings.NewReader(reportFixture), "browsers", 0, FailFast); err == nil {
+		t.Errorf("expected error for an unknown field")
+	}
+}
+
+func TestReportPolicy(t *testing.T) {
+	lines := strings.SplitAfter(reportFixture, "\n")
+	// the second user is cut short
+	fixture := lines[0] + lines[1][:40] + "\n" + lines[2]
+
+	if _, err := BuildReport(strings.NewReader(fixture), "country", 0, FailFast); err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+
+	expected, err := BuildReport(strings.NewReader(lines[0]+lines[2]), "country", 0, FailFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, policy := range []ParsePolicy{Skip, Collect} {
+		report, err := BuildReport(strings.NewReader(fixture), "country", 0, policy)
+		if err != nil {
+			t.Fatalf("[%d] unexpected error: %v", policy, err)
+		}
+		bad := report.BadLines
+		report.BadLines = nil
+		if !reflect.DeepEqual(report, expected) {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", policy, report, expected)
+		}
+		if policy == Collect && (len(bad) != 1 || bad[0].Line != 2 || bad[0].Offset != 40) {
+			t.Errorf("[%d] unexpected bad lines %v", policy, bad)
+		}
+	}
+}
+
+func TestReportCommand(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := run([]string{"report", "-by", "country", "-top", "3", "-format", "csv"}, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "country,") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if err := run([]string{"report", "-format", "xml"}, out); err == nil {
+		t.Errorf("expected error for an unknown format")
+	}
+	if err := run(nil, out); err == nil {
+		t.Errorf("expected usage error")
+	}
+
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, []byte(reportFixture+"oops\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"report", "-file", path}, out); err == nil || !strings.HasPrefix(err.Error(), "line 4: ") {
+		t.Errorf("expected error on line 4, got %v", err)
+	}
+	out.Reset()
+	if err := run([]string{"report", "-file", path, "-bad", "collect"}, out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Ecuador") || !strings.HasSuffix(out.String(), "\nBad lines 1\nline 4, offset 0: parse error: syntax error near offset 0 of 'oops'\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
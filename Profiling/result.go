@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Result - what a search has found
+type Result struct {
+	// Fields - the fields of Values in the order of the query
+	Fields []string    `json:"fields"`
+	Users  []FoundUser `json:"users"`
+	// Browsers - unique browsers the query looks for, in the order they were
+	// first seen; SlowSearch sees Android ones of a user before MSIE ones
+	Browsers []string `json:"browsers"`
+	// BadLines - lines that aren't users, with the Collect policy
+	BadLines []*ParseError `json:"bad_lines,omitempty"`
+}
+
+// FoundUser - a user that matches and the line index of it
+type FoundUser struct {
+	Line   int               `json:"line"`
+	Values map[string]string `json:"values"`
+}
+
+// ResultFormats - renderers of the result by name
+var ResultFormats = map[string]func(r *Result, out io.Writer) error{
+	"text": (*Result).WriteText,
+	"csv":  (*Result).WriteCSV,
+	"json": (*Result).WriteJSON,
+}
+
+// Find - Run that returns what it found instead of printing it
+func (q *Query) Find(in io.Reader) (*Result, error) {
+	result := &Result{Fields: q.Fields, Users: []FoundUser{}, Browsers: []string{}}
+	bad, err := q.scan(in, func(i int, user *User) error {
+		found := FoundUser{Line: i, Values: make(map[string]string, len(q.Fields))}
+		for _, field := range q.Fields {
+			found.Values[field] = q.value(field, user)
+		}
+		result.Users = append(result.Users, found)
+		return nil
+	}, func(browser string) {
+		// one entry per browser even if they are redacted to the same value
+		if redact := q.Redact["browsers"]; redact != nil {
+			browser = redact(browser)
+		}
+		result.Browsers = append(result.Browsers, browser)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.BadLines = bad
+	return result, nil
+}
+
+// WriteText - the result as Query.Run prints it
+func (r *Result) WriteText(out io.Writer) error {
+	buf := []byte("found users:\n")
+	for _, user := range r.Users {
+		buf = append(buf, '[')
+		buf = strconv.AppendInt(buf, int64(user.Line), 10)
+		buf = append(buf, "] "...)
+		for i, field := range r.Fields {
+			if i > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = appendField(buf, field, user.Values[field])
+		}
+		buf = append(buf, '\n')
+	}
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(out, "\nTotal unique browsers", len(r.Browsers)); err != nil {
+		return err
+	}
+	return writeBadLines(out, r.BadLines)
+}
+
+// WriteCSV - the users as CSV with a header: line and the fields
+func (r *Result) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Write(append([]string{"line"}, r.Fields...))
+	for _, user := range r.Users {
+		record := make([]string, 0, len(r.Fields)+1)
+		record = append(record, strconv.Itoa(user.Line))
+		for _, field := range r.Fields {
+			record = append(record, user.Values[field])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteJSON - the result as an indented JSON object
+func (r *Result) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var resultFixture = strings.Join([]string{
+	`{"browsers":["Android 4","MSIE 8"],"country":"Peru","email":"a@mail.ru","name":"A, Jr.","phone":"1"}`,
+	`{"browsers":["MSIE 9"],"country":"Peru","email":"b@mail.ru","name":"B","phone":"2"}`,
+	`{"browsers":["Android 5","Opera"],"country":"Chile","email":"c@mail.ru","name":"C","phone":"3"}`,
+}, "\n") + "\n"
+
+func TestFind(t *testing.T) {
+	query := MustCompile(`SELECT name, email, browsers WHERE browsers ~ "MSIE"`)
+	result, err := query.Find(strings.NewReader(resultFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Result{
+		Fields: []string{"name", "email", "browsers"},
+		Users: []FoundUser{
+			{0, map[string]string{"name": "A, Jr.", "email": "a@mail.ru", "browsers": "Android 4; MSIE 8"}},
+			{1, map[string]string{"name": "B", "email": "b@mail.ru", "browsers": "MSIE 9"}},
+		},
+		Browsers: []string{"MSIE 8", "MSIE 9"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+
+	runOut := new(bytes.Buffer)
+	query.Run(strings.NewReader(resultFixture), runOut)
+
+	cases := []struct {
+		Format   string
+		Expected string
+	}{
+		{"text", runOut.String()},
+		{"csv", "" +
+			"line,name,email,browsers\n" +
+			"0,\"A, Jr.\",a@mail.ru,Android 4; MSIE 8\n" +
+			"1,B,b@mail.ru,MSIE 9\n",
+		},
+	}
+	for idx, item := range cases {
+		out := new(bytes.Buffer)
+		if err := ResultFormats[item.Format](result, out); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if out.String() != item.Expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", idx, out.String(), item.Expected)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	result.WriteJSON(out)
+	decoded := &Result{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil || !reflect.DeepEqual(decoded, result) {
+		t.Errorf("json doesn't round trip: %v\n%s", err, out.String())
+	}
+
+	// browsers go in the order they were first seen
+	lines := strings.Split(strings.TrimSuffix(resultFixture, "\n"), "\n")
+	reversed := lines[2] + "\n" + lines[1] + "\n" + lines[0]
+	if result, err = query.Find(strings.NewReader(reversed)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"MSIE 9", "MSIE 8"}; !reflect.DeepEqual(result.Browsers, expected) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result.Browsers, expected)
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	for _, find := range []func(string) error{
+		func(in string) error { _, err := SlowSearch(strings.NewReader(in), FailFast); return err },
+		func(in string) error { _, err := FastSearch(strings.NewReader(in), FailFast); return err },
+	} {
+		if err := find(resultFixture + "{broken\n"); err == nil || !strings.HasPrefix(err.Error(), "line 4: ") {
+			t.Errorf("expected error on line 4, got %v", err)
+		}
+		if err := find(resultFixture); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strings"
+)
+
+// UserAgent - what a browsers entry says about the browser
+type UserAgent struct {
+	Family  string
+	Version string
+	OS      string
+	Device  string
+}
+
+// device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// Other - family or OS of user agents no rule knows
+const Other = "Other"
+
+type uaRule struct {
+	// token - the family is there if the user agent has it
+	token  string
+	family string
+	// version - the version follows it instead of the token
+	version string
+}
+
+// browserRules - the first rule whose token is in the user agent gives the
+// family, so browsers built on others go before them: Opera has Chrome/,
+// Chrome has Safari/
+var browserRules = []uaRule{
+	{token: "Edge/", family: "Edge"},
+	{token: "OPR/", family: "Opera"},
+	{token: "Opera Mini/", family: "Opera Mini"},
+	{token: "Opera/", family: "Opera", version: "Version/"},
+	{token: "Vivaldi/", family: "Vivaldi"},
+	{token: "SamsungBrowser/", family: "Samsung Internet"},
+	{token: "UCBrowser/", family: "UC Browser"},
+	{token: "YaBrowser/", family: "Yandex Browser"},
+	{token: "Maxthon/", family: "Maxthon"},
+	{token: "Puffin/", family: "Puffin"},
+	{token: "QupZilla/", family: "QupZilla"},
+	{token: "Epiphany/", family: "Epiphany"},
+	{token: "SeaMonkey/", family: "SeaMonkey"},
+	{token: "Iceweasel/", family: "Iceweasel"},
+	{token: "Camino/", family: "Camino"},
+	{token: "Minefield/", family: "Firefox"},
+	{token: "Galeon/", family: "Galeon"},
+	{token: "OmniWeb/", family: "OmniWeb"},
+	{token: "NokiaBrowser/", family: "Nokia Browser"},
+	{token: "BrowserNG/", family: "Nokia Browser"},
+	{token: "CriOS/", family: "Chrome"},
+	{token: "FxiOS/", family: "Firefox"},
+	{token: "Fennec/", family: "Firefox Mobile"},
+	{token: "Chromium/", family: "Chromium"},
+	{token: "Chrome/", family: "Chrome"},
+	{token: "Firefox/", family: "Firefox"},
+	{token: "IEMobile/", family: "IE Mobile"},
+	{token: "IEMobile ", family: "IE Mobile"},
+	{token: "MSIE ", family: "IE"},
+	{token: "Trident/", family: "IE", version: "rv:"},
+	{token: "Konqueror/", family: "Konqueror"},
+	{token: "NetFront/", family: "NetFront"},
+	{token: "Safari/", family: "Safari", version: "Version/"},
+	{token: "Mobile Safari", family: "Safari", version: "Version/"},
+	{token: "ELinks", family: "ELinks"},
+	{token: "Links (", family: "Links"},
+}
+
+// osRules - like browserRules, the first one with its token in the user agent
+var osRules = []uaRule{
+	{token: "Windows Phone", family: "Windows Phone"},
+	{token: "Windows CE", family: "Windows CE"},
+	{token: "WindowsCE", family: "Windows CE"},
+	{token: "Android", family: "Android"},
+	{token: "iPhone", family: "iOS"},
+	{token: "iPad", family: "iOS"},
+	{token: "iPod", family: "iOS"},
+	{token: "CFNetwork/", family: "iOS"},
+	{token: "Mac OS X", family: "Mac OS X"},
+	{token: "Macintosh", family: "Mac OS X"},
+	{token: "CrOS", family: "Chrome OS"},
+	{token: "Windows", family: "Windows"},
+	{token: "Win 9x", family: "Windows"},
+	{token: "Win95", family: "Windows"},
+	{token: "Win98", family: "Windows"},
+	{token: "Symbian", family: "Symbian"},
+	{token: "Series60", family: "Symbian"},
+	{token: "SymbOS", family: "Symbian"},
+	{token: "PalmOS", family: "Palm OS"},
+	{token: "BlackBerry", family: "BlackBerry"},
+	{token: "MeeGo", family: "MeeGo"},
+	{token: "BREW", family: "BREW"},
+	{token: "FreeBSD", family: "FreeBSD"},
+	{token: "OpenBSD", family: "OpenBSD"},
+	{token: "NetBSD", family: "NetBSD"},
+	{token: "OS/2", family: "OS/2"},
+	{token: "SunOS", family: "Solaris"},
+	{token: "IRIX", family: "IRIX"},
+	{token: "Linux", family: "Linux"},
+	{token: "X11", family: "Linux"},
+}
+
+// botTokens, mobileTokens - device classes by lower case substrings,
+// bots go first
+var (
+	botTokens    = []string{"bot", "spider", "crawl", "slurp", "mediapartners"}
+	mobileTokens = []string{"mobile", "mobi", "phone", "ipod", "windows ce", "symbian", "series60", "midp", "blackberry", "netfront", "up.link", "brew", "nokia", "sonyericsson", "j2me", "palmos", "wap"}
+)
+
+// ParseUserAgent - family, version, OS and device of the user agent;
+// a user agent no rule knows gets its first product, like iTunes/4.2
+func ParseUserAgent(ua string) UserAgent {
+	agent := UserAgent{Family: Other, OS: Other}
+
+	for _, rule := range browserRules {
+		if i := strings.Index(ua, rule.token); i != -1 {
+			agent.Family = rule.family
+			agent.Version = versionAfter(ua, i+len(rule.token))
+			if j := strings.Index(ua, rule.version); rule.version != "" && j != -1 {
+				agent.Version = versionAfter(ua, j+len(rule.version))
+			}
+			break
+		}
+	}
+	if agent.Family == Other && !strings.HasPrefix(ua, "Mozilla/") {
+		if slash := strings.IndexByte(ua, '/'); slash > 0 && !strings.ContainsAny(ua[:slash], "(;") {
+			agent.Family, agent.Version = ua[:slash], versionAfter(ua, slash+1)
+		}
+	}
+
+	for _, rule := range osRules {
+		if strings.Contains(ua, rule.token) {
+			agent.OS = rule.family
+			break
+		}
+	}
+
+	agent.Device = deviceOf(ua, agent.OS)
+	return agent
+}
+
+// versionAfter - the version that starts at i, up to a space, ; or )
+func versionAfter(ua string, i int) string {
+	end := i
+	for end < len(ua) && isVersionByte(ua[end]) {
+		end++
+	}
+	return ua[i:end]
+}
+
+func isVersionByte(c byte) bool {
+	return c == '.' || c == '_' || c == '-' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func deviceOf(ua, os string) string {
+	lower := strings.ToLower(ua)
+	for _, token := range botTokens {
+		if strings.Contains(lower, token) {
+			return DeviceBot
+		}
+	}
+	// Android tablets don't say Mobile
+	if strings.Contains(ua, "iPad") || strings.Contains(lower, "tablet") || (os == "Android" && !strings.Contains(ua, "Mobile")) {
+		return DeviceTablet
+	}
+	for _, token := range mobileTokens {
+		if strings.Contains(lower, token) {
+			return DeviceMobile
+		}
+	}
+	switch os {
+	case "iOS", "BREW":
+		return DeviceMobile
+	case "Windows", "Mac OS X", "Linux", "Chrome OS", "FreeBSD", "OpenBSD", "NetBSD", "OS/2", "Solaris", "IRIX":
+		return DeviceDesktop
+	}
+	return DeviceOther
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	// user agents from users.txt
+	cases := []struct {
+		UA       string
+		Expected UserAgent
+	}{
+		{
+			"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.0 Safari/537.36",
+			UserAgent{"Chrome", "41.0.2227.0", "Linux", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko",
+			UserAgent{"IE", "11.0", "Windows", DeviceDesktop},
+		},
+		{
+			"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0; Trident/5.0)",
+			UserAgent{"IE", "7.0", "Windows", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (compatible; MSIE 9.0; Windows Phone OS 7.5; Trident/5.0; IEMobile/9.0)",
+			UserAgent{"IE Mobile", "9.0", "Windows Phone", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (iPad; U; CPU OS 4_3 like Mac OS X; en-us) AppleWebKit/533.17.9 (KHTML, like Gecko) Version/5.0.2 Mobile/8F190 Safari/6533.18.5",
+			UserAgent{"Safari", "5.0.2", "iOS", DeviceTablet},
+		},
+		{
+			"Mozilla/5.0 (iPhone; U; CPU iPhone OS 5_1_1 like Mac OS X; da-dk) AppleWebKit/534.46.0 (KHTML, like Gecko) CriOS/19.0.1084.60 Mobile/9B206 Safari/7534.48.3",
+			UserAgent{"Chrome", "19.0.1084.60", "iOS", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 5.0.1; SCH-R970 Build/LRX22C) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/45.0.2454.84 Mobile Safari/537.36",
+			UserAgent{"Chrome", "45.0.2454.84", "Android", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 5.1.1; Nexus 7 Build/LMY47V) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/43.0.2357.78 Safari/537.36 OPR/30.0.1856.93524",
+			UserAgent{"Opera", "30.0.1856.93524", "Android", DeviceTablet},
+		},
+		{
+			"Opera/9.80 (Windows NT 6.1; WOW64) Presto/2.12.388 Version/12.16",
+			UserAgent{"Opera", "12.16", "Windows", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows Phone 10.0; Android 4.2.1; DEVICE INFO) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/39.0.2171.71 Mobile Safari/537.36 Edge/12.0",
+			UserAgent{"Edge", "12.0", "Windows Phone", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.12; rv:49.0) Gecko/20100101 Firefox/49.0",
+			UserAgent{"Firefox", "49.0", "Mac OS X", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (X11; CrOS x86_64 5841.83.0) AppleWebKit/537.36 (KHTML like Gecko) Chrome/36.0.1985.138 Safari/537.36",
+			UserAgent{"Chrome", "36.0.1985.138", "Chrome OS", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (SymbianOS/9.2; U; Series60/3.1 NokiaE90-1/07.24.0.3; Profile/MIDP-2.0 Configuration/CLDC-1.1 ) AppleWebKit/413 (KHTML, like Gecko) Safari/413 UP.Link/6.2.3.18.0",
+			UserAgent{"Safari", "413", "Symbian", DeviceMobile},
+		},
+		{
+			"SonyEricssonW580i/R6BC Browser/NetFront/3.3 Profile/MIDP-2.0 Configuration/CLDC-1.1",
+			UserAgent{"NetFront", "3.3", Other, DeviceMobile},
+		},
+		{
+			"iTunes/4.2 (Macintosh; U; PPC Mac OS X 10.2)",
+			UserAgent{"iTunes", "4.2", "Mac OS X", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1;  http://www.google.com/bot.html)",
+			UserAgent{Other, "", Other, DeviceBot},
+		},
+		{
+			"Baiduspider ( http://www.baidu.com/search/spider.htm)",
+			UserAgent{Other, "", Other, DeviceBot},
+		},
+		{
+			"Adobe Application Manager 2.0",
+			UserAgent{Other, "", Other, DeviceOther},
+		},
+	}
+
+	for idx, item := range cases {
+		result := ParseUserAgent(item.UA)
+		if result != item.Expected {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Converter - turns a value of the json tree into a value of the destination type
+type Converter func(in interface{}) (interface{}, error)
+
+// Hook - normalises every value of the json tree before it's assigned,
+// to is the destination type
+type Hook func(in interface{}, to reflect.Type) (interface{}, error)
+
+// Unmarshaler - types that convert themselves, like json.Unmarshaler;
+// in is the raw value of the json tree, nil for null
+type Unmarshaler interface {
+	UnmarshalI2S(in interface{}) error
+}
+
+type converterKey struct {
+	from reflect.Kind
+	to   reflect.Type
+}
+
+var (
+	convertersMu sync.RWMutex
+	converters   = map[converterKey]Converter{}
+
+	hooks atomic.Value // []Hook
+
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// RegisterConverter - use fn for values of kind from (reflect.Float64 for json
+// numbers) going to the type to; reflect.Interface as from matches any kind
+func RegisterConverter(from reflect.Kind, to reflect.Type, fn Converter) {
+	convertersMu.Lock()
+	converters[converterKey{from, to}] = fn
+	convertersMu.Unlock()
+	resetPlans()
+}
+
+// RegisterHook - hooks run in the order of registration
+func RegisterHook(hook Hook) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	registered, _ := hooks.Load().([]Hook)
+	hooks.Store(append(registered[:len(registered):len(registered)], hook))
+}
+
+// resetPlans - plans have converters built in, they are rebuilt after a change
+func resetPlans() {
+	plans.Range(func(typ, _ interface{}) bool {
+		plans.Delete(typ)
+		return true
+	})
+	structPlans.Range(func(typ, _ interface{}) bool {
+		structPlans.Delete(typ)
+		return true
+	})
+}
+
+// typeConverters - registered converters to the type by source kind
+func typeConverters(typ reflect.Type) map[reflect.Kind]Converter {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+
+	result := map[reflect.Kind]Converter{}
+	for key, fn := range converters {
+		if key.to == typ {
+			result[key.from] = fn
+		}
+	}
+	return result
+}
+
+// withConverters - the plan of the type with registered converters in front
+func withConverters(typ reflect.Type, plan copyFunc) copyFunc {
+	byKind := typeConverters(typ)
+	if len(byKind) == 0 {
+		return plan
+	}
+
+	return func(json, struc reflect.Value, path string, d *decoder) error {
+		fn, ok := byKind[json.Kind()]
+		if !ok {
+			if fn, ok = byKind[reflect.Interface]; !ok {
+				return plan(json, struc, path, d)
+			}
+		}
+
+		out, err := fn(json.Interface())
+		if err != nil {
+			return d.fail(path, json, struc, err)
+		}
+		result := reflect.ValueOf(out)
+		switch {
+		case !result.IsValid():
+			struc.Set(reflect.Zero(typ))
+		case result.Type().AssignableTo(typ):
+			struc.Set(result)
+		case result.Type().ConvertibleTo(typ):
+			struc.Set(result.Convert(typ))
+		default:
+			return d.fail(path, json, struc, fmt.Errorf("converter gave %s for %s", result.Type(), typ))
+		}
+		return nil
+	}
+}
+
+// withUnmarshaler - types with UnmarshalI2S get every value as is, null included
+func withUnmarshaler(typ reflect.Type, plan copyFunc) copyFunc {
+	if typ.Kind() == reflect.Interface || !reflect.PtrTo(typ).Implements(unmarshalerType) {
+		return plan
+	}
+
+	return func(json, struc reflect.Value, path string, d *decoder) error {
+		for json.Kind() == reflect.Interface {
+			json = json.Elem()
+		}
+		var in interface{}
+		if json.IsValid() {
+			in = json.Interface()
+		}
+		if err := struc.Addr().Interface().(Unmarshaler).UnmarshalI2S(in); err != nil {
+			return d.fail(path, json, struc, err)
+		}
+		return nil
+	}
+}
+
+// withHooks - registered hooks run on the value before the plan;
+// pointers get them through the plan of their element
+func withHooks(typ reflect.Type, plan copyFunc) copyFunc {
+	if typ.Kind() == reflect.Ptr {
+		return plan
+	}
+	return func(json, struc reflect.Value, path string, d *decoder) error {
+		registered, _ := hooks.Load().([]Hook)
+		if len(registered) == 0 {
+			return plan(json, struc, path, d)
+		}
+
+		for json.Kind() == reflect.Interface {
+			json = json.Elem()
+		}
+		var in interface{}
+		if json.IsValid() {
+			in = json.Interface()
+		}
+		for _, hook := range registered {
+			out, err := hook(in, typ)
+			if err != nil {
+				return d.fail(path, json, struc, err)
+			}
+			in = out
+		}
+		return plan(reflect.ValueOf(in), struc, path, d)
+	}
+}
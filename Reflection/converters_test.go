@@ -0,0 +1,162 @@
+package convert
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type UUID [16]byte
+
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+)
+
+// Decimal - fixed point with two digits after the dot
+type Decimal struct {
+	Cents int64
+}
+
+func (dec *Decimal) UnmarshalI2S(in interface{}) error {
+	switch in := in.(type) {
+	case nil:
+		dec.Cents = 0
+	case float64:
+		dec.Cents = int64(in*100 + 0.5)
+	case string:
+		parts := strings.SplitN(in+".00", ".", 3)
+		units, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		cents, err := strconv.ParseInt((parts[1] + "00")[:2], 10, 64)
+		if err != nil {
+			return err
+		}
+		dec.Cents = units*100 + cents
+	default:
+		return fmt.Errorf("bad decimal %v", in)
+	}
+	return nil
+}
+
+type Event struct {
+	ID     UUID
+	Level  Level
+	Price  Decimal
+	Fee    *Decimal
+	Parent *UUID
+	Tags   []Level
+}
+
+func init() {
+	RegisterConverter(reflect.String, reflect.TypeOf(UUID{}), func(in interface{}) (interface{}, error) {
+		raw, err := hex.DecodeString(strings.Replace(in.(string), "-", "", -1))
+		if err != nil || len(raw) != 16 {
+			return nil, fmt.Errorf("bad uuid %q", in)
+		}
+		uuid := UUID{}
+		copy(uuid[:], raw)
+		return uuid, nil
+	})
+	levels := map[string]Level{"debug": Debug, "info": Info, "warn": Warn}
+	RegisterConverter(reflect.String, reflect.TypeOf(Level(0)), func(in interface{}) (interface{}, error) {
+		level, ok := levels[in.(string)]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", in)
+		}
+		return level, nil
+	})
+}
+
+func TestConverters(t *testing.T) {
+	uuid := UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	cases := []struct {
+		JsonData string
+		Expected Event
+	}{
+		{
+			`{"ID":"123e4567-e89b-12d3-a456-426614174000","Level":"warn","Price":"10.5","Fee":0.25,"Parent":"123e4567e89b12d3a456426614174000","Tags":["info",0]}`,
+			Event{ID: uuid, Level: Warn, Price: Decimal{1050}, Fee: &Decimal{25}, Parent: &uuid, Tags: []Level{Info, Debug}},
+		},
+		// numbers still go the usual way, null goes to UnmarshalI2S
+		{
+			`{"Level":1,"Price":null,"Fee":null}`,
+			Event{Level: Info},
+		},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		result := Event{}
+		if err := i2s(tmpData, &result); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+
+	for idx, jsonData := range []string{
+		`{"ID":"not a uuid"}`,
+		`{"Tags":["info","fatal"]}`,
+		`{"Price":"ten"}`,
+		`{"Price":true}`,
+	} {
+		var tmpData interface{}
+		json.Unmarshal([]byte(jsonData), &tmpData)
+
+		var fieldErr *FieldError
+		if err := i2s(tmpData, &Event{}); !errors.As(err, &fieldErr) {
+			t.Errorf("[%d] expected FieldError, got %v", idx, err)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	defer hooks.Store([]Hook(nil))
+	RegisterHook(func(in interface{}, to reflect.Type) (interface{}, error) {
+		if str, ok := in.(string); ok {
+			return strings.TrimSpace(str), nil
+		}
+		return in, nil
+	})
+	// "42" for numbers, like query strings have them
+	RegisterHook(func(in interface{}, to reflect.Type) (interface{}, error) {
+		str, ok := in.(string)
+		if !ok || to.Kind() != reflect.Int {
+			return in, nil
+		}
+		return strconv.ParseFloat(str, 64)
+	})
+
+	var tmpData interface{}
+	json.Unmarshal([]byte(`{"ID":" 42 ","Username":"  rvasily ","Active":true}`), &tmpData)
+
+	result := Simple{}
+	if err := i2s(tmpData, &result); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := Simple{42, "rvasily", true}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+
+	json.Unmarshal([]byte(`{"ID":"forty two"}`), &tmpData)
+	var fieldErr *FieldError
+	if err := i2s(tmpData, &Simple{}); !errors.As(err, &fieldErr) || fieldErr.Path != "ID" {
+		t.Errorf("expected FieldError for ID, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiffKind - what happened to the value at the path
+type DiffKind string
+
+const (
+	Changed DiffKind = "changed"
+	Added   DiffKind = "added"
+	Removed DiffKind = "removed"
+)
+
+// Difference - one difference of b from a, A is nil for added values
+// and B for removed ones
+type Difference struct {
+	Path string
+	Kind DiffKind
+	A    interface{}
+	B    interface{}
+}
+
+// Diffs - all differences in the order of fields, indexes and sorted keys
+type Diffs []Difference
+
+// DiffOptions - what Diff doesn't count as a difference
+type DiffOptions struct {
+	// IgnoreFields - struct field names or full paths like ManySimple[1].Username
+	IgnoreFields []string
+	// IgnoreUnexported - skip unexported struct fields
+	IgnoreUnexported bool
+	// FloatTolerance - floats closer than that are equal
+	FloatTolerance float64
+}
+
+type visitPair struct {
+	a, b uintptr
+	typ  reflect.Type
+}
+
+type differ struct {
+	opts    DiffOptions
+	ignore  map[string]bool
+	visited map[visitPair]bool
+	diffs   Diffs
+}
+
+// Diff - differences of b from a; nil and empty slices and maps are equal
+func Diff(a, b interface{}) Diffs {
+	return DiffWith(a, b, DiffOptions{})
+}
+
+// DiffWith - Diff with options
+func DiffWith(a, b interface{}, opts DiffOptions) Diffs {
+	d := &differ{
+		opts:    opts,
+		ignore:  map[string]bool{},
+		visited: map[visitPair]bool{},
+	}
+	for _, field := range opts.IgnoreFields {
+		d.ignore[field] = true
+	}
+	d.diff(reflect.ValueOf(a), reflect.ValueOf(b), "")
+	return d.diffs
+}
+
+func (d *differ) add(kind DiffKind, path string, a, b reflect.Value) {
+	d.diffs = append(d.diffs, Difference{Path: path, Kind: kind, A: valueOf(a), B: valueOf(b)})
+}
+
+// valueOf - the value itself, or how it prints if it's unexported
+func valueOf(val reflect.Value) interface{} {
+	if !val.IsValid() {
+		return nil
+	}
+	if !val.CanInterface() {
+		return fmt.Sprintf("%v", val)
+	}
+	return val.Interface()
+}
+
+func (d *differ) diff(a, b reflect.Value, path string) {
+	switch {
+	case !a.IsValid() && !b.IsValid():
+		return
+	case !a.IsValid():
+		d.add(Added, path, a, b)
+		return
+	case !b.IsValid():
+		d.add(Removed, path, a, b)
+		return
+	case a.Type() != b.Type():
+		d.add(Changed, path, a, b)
+		return
+	}
+
+	// the same instant in other locations is the same time
+	if a.Type() == timeType && a.CanInterface() {
+		if !a.Interface().(time.Time).Equal(b.Interface().(time.Time)) {
+			d.add(Changed, path, a, b)
+		}
+		return
+	}
+
+	switch a.Kind() {
+
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			switch {
+			case a.IsNil() && !b.IsNil():
+				d.add(Added, path, reflect.Value{}, b)
+			case !a.IsNil() && b.IsNil():
+				d.add(Removed, path, a, reflect.Value{})
+			}
+			return
+		}
+		if a.Kind() == reflect.Ptr {
+			pair := visitPair{a.Pointer(), b.Pointer(), a.Type()}
+			if d.visited[pair] {
+				return
+			}
+			d.visited[pair] = true
+		}
+		d.diff(a.Elem(), b.Elem(), path)
+
+	case reflect.Struct:
+		typ := a.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			fieldPath := fieldPath(path, field.Name)
+			if d.ignore[field.Name] || d.ignore[fieldPath] || (d.opts.IgnoreUnexported && field.PkgPath != "") {
+				continue
+			}
+			d.diff(a.Field(i), b.Field(i), fieldPath)
+		}
+
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, key := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[fmt.Sprint(valueOf(key))] = key
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			keyPath := keyPath(path, name)
+			if d.ignore[keyPath] {
+				continue
+			}
+			d.diff(a.MapIndex(keys[name]), b.MapIndex(keys[name]), keyPath)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < a.Len() || i < b.Len(); i++ {
+			indexPath := indexPath(path, i)
+			if d.ignore[indexPath] {
+				continue
+			}
+			var elemA, elemB reflect.Value
+			if i < a.Len() {
+				elemA = a.Index(i)
+			}
+			if i < b.Len() {
+				elemB = b.Index(i)
+			}
+			d.diff(elemA, elemB, indexPath)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		if math.IsNaN(x) && math.IsNaN(y) {
+			return
+		}
+		if x != y && !(math.Abs(x-y) <= d.opts.FloatTolerance) {
+			d.add(Changed, path, a, b)
+		}
+
+	default:
+		if !scalarEqual(a, b) {
+			d.add(Changed, path, a, b)
+		}
+	}
+}
+
+// scalarEqual - == for values that may be unexported
+func scalarEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	}
+	return false
+}
+
+// String - one line per difference:
+// "~ path: a -> b" for changed, "+ path: b" for added, "- path: a" for removed
+func (diffs Diffs) String() string {
+	lines := make([]string, len(diffs))
+	for i, diff := range diffs {
+		path := diff.Path
+		if path == "" {
+			path = "(root)"
+		}
+		switch diff.Kind {
+		case Added:
+			lines[i] = fmt.Sprintf("+ %s: %#v", path, diff.B)
+		case Removed:
+			lines[i] = fmt.Sprintf("- %s: %#v", path, diff.A)
+		default:
+			lines[i] = fmt.Sprintf("~ %s: %#v -> %#v", path, diff.A, diff.B)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
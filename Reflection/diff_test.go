@@ -0,0 +1,110 @@
+package convert
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Measure struct {
+	Name    string
+	Value   float64
+	Taken   time.Time
+	Labels  map[string]string
+	Points  []int
+	Source  *Simple
+	Any     interface{}
+	comment string
+}
+
+func TestDiff(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	taken := time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC)
+	a := Measure{
+		Name:    "cpu",
+		Value:   0.3 + 1e-12,
+		Taken:   taken,
+		Labels:  map[string]string{"host": "a", "dc": "msk"},
+		Points:  []int{1, 2, 3},
+		Source:  &Simple{ID: 42, Username: "rvasily"},
+		comment: "old",
+	}
+	b := Measure{
+		Name:    "cpu",
+		Value:   0.3,
+		Taken:   taken.In(moscow),
+		Labels:  map[string]string{"host": "b", "rack": "1"},
+		Points:  []int{1, 5},
+		Source:  &Simple{ID: 42, Username: "other"},
+		Any:     1.5,
+		comment: "new",
+	}
+
+	expected := Diffs{
+		{Path: "Value", Kind: Changed, A: a.Value, B: 0.3},
+		{Path: `Labels["dc"]`, Kind: Removed, A: "msk"},
+		{Path: `Labels["host"]`, Kind: Changed, A: "a", B: "b"},
+		{Path: `Labels["rack"]`, Kind: Added, B: "1"},
+		{Path: "Points[1]", Kind: Changed, A: 2, B: 5},
+		{Path: "Points[2]", Kind: Removed, A: 3},
+		{Path: "Source.Username", Kind: Changed, A: "rvasily", B: "other"},
+		{Path: "Any", Kind: Added, B: 1.5},
+		{Path: "comment", Kind: Changed, A: "old", B: "new"},
+	}
+	result := Diff(a, b)
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	expected = Diffs{
+		{Path: "Points[1]", Kind: Changed, A: 2, B: 5},
+		{Path: "Points[2]", Kind: Removed, A: 3},
+		{Path: "Any", Kind: Added, B: 1.5},
+	}
+	result = DiffWith(a, b, DiffOptions{
+		IgnoreFields:     []string{"Labels", "Source.Username"},
+		IgnoreUnexported: true,
+		FloatTolerance:   1e-9,
+	})
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestDiffEqual(t *testing.T) {
+	loop := &Node{Name: "a"}
+	loop.Next = loop
+	loopCopy := &Node{Name: "a"}
+	loopCopy.Next = loopCopy
+
+	cases := []struct{ A, B interface{} }{
+		{nil, nil},
+		{Simple{42, "rvasily", true}, Simple{42, "rvasily", true}},
+		{[]int(nil), []int{}},
+		{map[string]int(nil), map[string]int{}},
+		{math.NaN(), math.NaN()},
+		{loop, loopCopy},
+	}
+	for idx, item := range cases {
+		if result := Diff(item.A, item.B); len(result) != 0 {
+			t.Errorf("[%d] unexpected differences:\n%v", idx, result)
+		}
+	}
+}
+
+func TestDiffString(t *testing.T) {
+	result := Diffs{
+		{Path: "ManySimple[1].Username", Kind: Changed, A: "rvasily", B: "other"},
+		{Path: "Blocks[2]", Kind: Added, B: IDBlock{42}},
+		{Path: `Counts["a"]`, Kind: Removed, A: 1},
+		{Path: "", Kind: Changed, A: 1, B: "1"},
+	}.String()
+	expected := `~ ManySimple[1].Username: "rvasily" -> "other"
++ Blocks[2]: convert.IDBlock{ID:42}
+- Counts["a"]: 1
+~ (root): 1 -> "1"`
+	if result != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
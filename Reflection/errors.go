@@ -0,0 +1,95 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError - a value that can't be assigned to its place in the struct
+type FieldError struct {
+	// Path - where in the input, like ManySimple[1].Username, empty for the root
+	Path string
+	// Expected - type of the destination
+	Expected string
+	// Actual - json kind of the value: null, bool, number, string, array or object
+	Actual string
+	// Err - the reason if it's not just a kind mismatch
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	msg := fmt.Sprintf("expected %s, got %s", e.Expected, e.Actual)
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	// validation messages name the field themselves
+	if _, ok := e.Err.(*ValidationError); ok || e.Path == "" {
+		return msg
+	}
+	return e.Path + ": " + msg
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors - all field errors of Decode with CollectErrors
+type Errors []*FieldError
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (errs Errors) Unwrap() []error {
+	result := make([]error, len(errs))
+	for i, err := range errs {
+		result[i] = err
+	}
+	return result
+}
+
+// jsonKind - how the value would look in json
+func jsonKind(json reflect.Value) string {
+	for json.Kind() == reflect.Interface {
+		json = json.Elem()
+	}
+	if !json.IsValid() {
+		return "null"
+	}
+	switch json.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return json.Type().String()
+}
+
+func fieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+func keyPath(path, key string) string {
+	return path + "[" + strconv.Quote(key) + "]"
+}
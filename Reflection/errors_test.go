@@ -0,0 +1,111 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFieldErrors(t *testing.T) {
+	cases := []struct {
+		Result   interface{}
+		JsonData string
+		Expected FieldError
+	}{
+		{
+			&Complex{},
+			`{"ManySimple":[{"ID":1},{"Username":100500}]}`,
+			FieldError{Path: "ManySimple[1].Username", Expected: "string", Actual: "number"},
+		},
+		{
+			&Simple{},
+			`[{"ID":42}]`,
+			FieldError{Path: "", Expected: "convert.Simple", Actual: "array"},
+		},
+		{
+			&Containers{},
+			`{"ByName":{"admin":{"Active":"DA"}}}`,
+			FieldError{Path: `ByName["admin"].Active`, Expected: "bool", Actual: "string"},
+		},
+		{
+			&Numbers{},
+			`{"I8":null}`,
+			FieldError{Path: "I8", Expected: "int8", Actual: "null"},
+		},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		err := i2s(tmpData, item.Result)
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) {
+			t.Errorf("[%d] expected FieldError, got %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, *fieldErr) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, *fieldErr, item.Expected)
+		}
+	}
+}
+
+func TestFieldErrorReason(t *testing.T) {
+	var tmpData interface{}
+	json.Unmarshal([]byte(`{"Pair":[{"ID":1.5},{"ID":1}]}`), &tmpData)
+
+	err := i2s(tmpData, &Containers{})
+	expected := "Pair[0].ID: 1.5 is not an integer for int"
+	if err == nil || err.Error() != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", err, expected)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	var tmpData interface{}
+	json.Unmarshal([]byte(`{"ID":"42","Username":"rvasily","Active":"DA","unknown":1}`), &tmpData)
+
+	result := Simple{}
+	err := Decode(tmpData, &result, Options{CollectErrors: true, Strict: true})
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	paths := map[string]bool{}
+	for _, fieldErr := range errs {
+		paths[fieldErr.Path] = true
+	}
+	expected := map[string]bool{"ID": true, "Active": true, "unknown": true}
+	if !reflect.DeepEqual(expected, paths) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", paths, expected)
+	}
+	// good fields are still assigned
+	if result.Username != "rvasily" {
+		t.Errorf("Username is not assigned: %#v", result)
+	}
+
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Errorf("expected FieldError inside Errors")
+	}
+
+	if err := Decode(tmpData, &Tagged{}, Options{CollectErrors: true}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// map keys come in random order, the errors don't
+	input := map[string]interface{}{}
+	for _, key := range []string{"e", "a", "d", "b", "c"} {
+		input[key] = "x"
+	}
+	messages := `["a"]: expected int, got string` + "\n" + `["b"]: expected int, got string` + "\n" +
+		`["c"]: expected int, got string` + "\n" + `["d"]: expected int, got string` + "\n" + `["e"]: expected int, got string`
+	for i := 0; i < 10; i++ {
+		err := Decode(input, &map[string]int{}, Options{CollectErrors: true})
+		if err == nil || err.Error() != messages {
+			t.Fatalf("[%d] results not match\nGot:\n%v\nExpected:\n%v", i, err, messages)
+		}
+	}
+}
@@ -2,77 +2,227 @@ package convert
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
-func recursiveCopy(json reflect.Value, struc reflect.Value) error {
-	isObject := (json.Kind() == reflect.Map && struc.Kind() == reflect.Struct)
-	isArray := (json.Kind() == reflect.Slice && struc.Kind() == reflect.Slice)
-	if !(isObject || isArray) {
-		return fmt.Errorf(
-			"(in-out) Only object-struct or array-slice\n"+
-				"in: %v\nout:%#v", json, struc,
-		)
+// Options - i2s behaviour, the zero value is plain i2s
+type Options struct {
+	// Strict - error on keys that match no struct field instead of skipping them
+	Strict bool
+	// CollectErrors - go on after a bad field and return all of them as Errors
+	CollectErrors bool
+	// Validate - check apivalidator tags of the structs after decoding them
+	Validate bool
+	// WeaklyTyped - strings for numbers and bools, a single value for a slice;
+	// for sources that have nothing but strings, like url.Values
+	WeaklyTyped bool
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// keyName - the map key of a struct field: name from the i2s tag, then from
+// the json tag, then the field name itself; "-" skips the field
+func keyName(field reflect.StructField) (string, bool) {
+	name, tagged, _ := tagName(field)
+	if name == "-" || field.PkgPath != "" {
+		return "", false
 	}
+	if !tagged {
+		return field.Name, true
+	}
+	return name, true
+}
 
-	switch json.Kind() {
+// tagName - name and omitempty option of the first i2s or json tag with a name
+func tagName(field reflect.StructField) (name string, tagged bool, omitEmpty bool) {
+	for _, tagName := range []string{"i2s", "json"} {
+		tag, ok := field.Tag.Lookup(tagName)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if parts[0] != "" {
+			return parts[0], true, omitEmpty
+		}
+	}
+	return "", false, omitEmpty
+}
 
-	case reflect.Map:
-		iter := json.MapRange()
-		for iter.Next() {
-			jsonKey := iter.Key().String()
-			jsonField := iter.Value().Elem()
-			strucField := struc.FieldByName(jsonKey)
-
-			switch jsonField.Kind() {
-			case reflect.Bool, reflect.String, reflect.Float64:
-				if strucField.Kind() == reflect.Int && jsonField.Kind() == reflect.Float64 {
-					jsonField = jsonField.Convert(strucField.Type())
-				}
-				if jsonField.Kind() != strucField.Kind() {
-					return fmt.Errorf(
-						"Fields are not assigned\n"+
-							"%v<->%#v", jsonField, strucField,
-					)
-				}
-
-				strucField.Set(jsonField)
-			case reflect.Map, reflect.Slice:
-				err := recursiveCopy(jsonField, strucField)
-				if err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf(
-					"Field type <%s> not implemented\n%v",
-					jsonField.Type(), json,
-				)
+type fieldInfo struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields - fields of the struct by their keys, fields of embedded
+// structs are promoted unless shadowed by the outer ones
+func structFields(typ reflect.Type) []fieldInfo {
+	fields := []fieldInfo{}
+	seen := map[string]bool{}
+
+	var walk func(typ reflect.Type, index []int, visited map[reflect.Type]bool)
+	walk = func(typ reflect.Type, index []int, visited map[reflect.Type]bool) {
+		visited[typ] = true
+		embedded := []reflect.StructField{}
+
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if _, tagged, _ := tagName(field); field.Anonymous && !tagged && fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, field)
+				continue
+			}
+
+			name, ok := keyName(field)
+			if !ok || seen[name] {
+				continue
 			}
+			seen[name] = true
+			_, _, omitEmpty := tagName(field)
+			fields = append(fields, fieldInfo{name, append(append([]int{}, index...), i), omitEmpty})
 		}
 
-	case reflect.Slice:
-		struc.Set(reflect.MakeSlice(
-			struc.Type(), json.Len(), json.Cap(),
-		))
-
-		for i := 0; i < json.Len(); i++ {
-			err := recursiveCopy(
-				json.Index(i).Elem(),
-				struc.Index(i),
-			)
-			if err != nil {
-				return err
+		for _, field := range embedded {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if !visited[fieldType] {
+				walk(fieldType, append(append([]int{}, index...), field.Index[0]), visited)
 			}
 		}
+		delete(visited, typ)
 	}
+	walk(typ, nil, map[reflect.Type]bool{})
+
+	return fields
+}
 
+// decoder - state of one Decode call
+type decoder struct {
+	opts Options
+	errs Errors
+}
+
+// fail reports the error at the path: returns it to abort the conversion,
+// or keeps it and returns nil to go on with CollectErrors
+func (d *decoder) fail(path string, json reflect.Value, struc reflect.Value, err error) error {
+	fieldErr := &FieldError{
+		Path:     path,
+		Expected: struc.Type().String(),
+		Actual:   jsonKind(json),
+		Err:      err,
+	}
+	if !d.opts.CollectErrors {
+		return fieldErr
+	}
+	d.errs = append(d.errs, fieldErr)
+	return nil
+}
+
+// err - the collected errors sorted by path, so maps give them in the same
+// order every time; nil if there are none
+func (d *decoder) err() error {
+	if len(d.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(d.errs, func(i, j int) bool { return d.errs[i].Path < d.errs[j].Path })
+	return d.errs
+}
+
+// setNumber - json numbers are float64, they fit an integer field only
+// if they have no fraction and don't overflow it
+func setNumber(json reflect.Value, struc reflect.Value) error {
+	var (
+		f        float64
+		isInt    bool
+		i        int64
+		isUint   bool
+		u        uint64
+		overflow bool
+	)
+
+	switch json.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f = json.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, isInt = json.Int(), true
+		f = float64(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, isUint = json.Uint(), true
+		f = float64(u)
+	default:
+		return fmt.Errorf("%v is not a number", json)
+	}
+
+	switch struc.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if overflow = struc.OverflowFloat(f); !overflow {
+			struc.SetFloat(f)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch {
+		case isInt:
+		case isUint:
+			i, overflow = int64(u), u > math.MaxInt64
+		case f != math.Trunc(f):
+			return fmt.Errorf("%v is not an integer for %s", f, struc.Type())
+		default:
+			i, overflow = int64(f), f < math.MinInt64 || f >= math.MaxInt64
+		}
+		if overflow = overflow || struc.OverflowInt(i); !overflow {
+			struc.SetInt(i)
+		}
+
+	default:
+		switch {
+		case isUint:
+		case isInt:
+			u, overflow = uint64(i), i < 0
+		case f != math.Trunc(f):
+			return fmt.Errorf("%v is not an integer for %s", f, struc.Type())
+		default:
+			u, overflow = uint64(f), f < 0 || f >= math.MaxUint64
+		}
+		if overflow = overflow || struc.OverflowUint(u); !overflow {
+			struc.SetUint(u)
+		}
+	}
+
+	if overflow {
+		return fmt.Errorf("%v overflows %s", json, struc.Type())
+	}
 	return nil
 }
 
 func i2s(data interface{}, out interface{}) error {
+	return Decode(data, out, Options{})
+}
+
+// Decode - i2s with options
+func Decode(data interface{}, out interface{}, opts Options) error {
 	json, strucPtr := reflect.ValueOf(data), reflect.ValueOf(out)
-	if strucPtr.Kind() != reflect.Ptr {
+	if strucPtr.Kind() != reflect.Ptr || strucPtr.IsNil() {
 		return fmt.Errorf("Should be pointer in out value")
 	}
-	return recursiveCopy(json, strucPtr.Elem())
+	struc := strucPtr.Elem()
+	d := &decoder{opts: opts}
+	if err := planFor(struc.Type())(json, struc, "", d); err != nil {
+		return err
+	}
+	return d.err()
 }
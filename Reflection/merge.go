@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// merge strategies of the `merge:"..."` tag
+const (
+	// MergeReplace - non-zero src replaces dst as a whole
+	MergeReplace = "replace"
+	// MergeAppend - src slice is appended to dst slice
+	MergeAppend = "append"
+	// MergeDeep - structs and maps by fields and keys, slices by index
+	MergeDeep = "merge"
+)
+
+// Merge - copies non-zero values of src into dst, dst is a pointer, src is
+// a value or a pointer of the same type. By default structs and maps are
+// merged deep, slices and everything else are replaced
+func Merge(dst interface{}, src interface{}) error {
+	dstPtr := reflect.ValueOf(dst)
+	if dstPtr.Kind() != reflect.Ptr || dstPtr.IsNil() {
+		return fmt.Errorf("Should be pointer in dst value")
+	}
+
+	srcVal := reflect.ValueOf(src)
+	for srcVal.Kind() == reflect.Ptr && srcVal.Type() != dstPtr.Type().Elem() {
+		if srcVal.IsNil() {
+			return nil
+		}
+		srcVal = srcVal.Elem()
+	}
+	if !srcVal.IsValid() {
+		return nil
+	}
+	if srcVal.Type() != dstPtr.Type().Elem() {
+		return fmt.Errorf("can't merge %s into %s", srcVal.Type(), dstPtr.Type().Elem())
+	}
+
+	return mergeValue(dstPtr.Elem(), srcVal, "", "")
+}
+
+func mergeValue(dst reflect.Value, src reflect.Value, strategy string, path string) error {
+	switch strategy {
+	case "", MergeReplace, MergeDeep:
+	case MergeAppend:
+		if dst.Kind() != reflect.Slice {
+			return fmt.Errorf("%s: append strategy for %s", path, dst.Type())
+		}
+	default:
+		return fmt.Errorf("%s: unknown merge strategy %q", path, strategy)
+	}
+
+	if src.IsZero() {
+		return nil
+	}
+	if strategy == MergeReplace || dst.Type() == timeType {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Kind() {
+
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return mergeValue(dst.Elem(), src.Elem(), strategy, path)
+
+	case reflect.Struct:
+		for _, field := range structFields(dst.Type()) {
+			srcField, ok := fieldByIndex(src, field.index)
+			if !ok || srcField.IsZero() {
+				continue
+			}
+			tag := dst.Type().FieldByIndex(field.index).Tag.Get("merge")
+			err := mergeValue(allocField(dst, field.index), srcField, tag, fieldPath(path, field.name))
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			// map values are not addressable, merge a copy and put it back
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if old := dst.MapIndex(iter.Key()); old.IsValid() {
+				elem.Set(old)
+			}
+			err := mergeValue(elem, iter.Value(), "", keyPath(path, fmt.Sprint(iter.Key())))
+			if err != nil {
+				return err
+			}
+			dst.SetMapIndex(iter.Key(), elem)
+		}
+
+	case reflect.Slice:
+		switch strategy {
+		case MergeAppend:
+			dst.Set(reflect.AppendSlice(dst, src))
+		case MergeDeep:
+			if dst.Len() < src.Len() {
+				dst.Set(reflect.AppendSlice(dst, reflect.MakeSlice(dst.Type(), src.Len()-dst.Len(), src.Len()-dst.Len())))
+			}
+			for i := 0; i < src.Len(); i++ {
+				if err := mergeValue(dst.Index(i), src.Index(i), "", indexPath(path, i)); err != nil {
+					return err
+				}
+			}
+		default:
+			dst.Set(src)
+		}
+
+	case reflect.Array:
+		if strategy != MergeDeep {
+			dst.Set(src)
+			return nil
+		}
+		for i := 0; i < src.Len(); i++ {
+			if err := mergeValue(dst.Index(i), src.Index(i), "", indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+
+	default:
+		dst.Set(src)
+	}
+
+	return nil
+}
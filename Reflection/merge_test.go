@@ -0,0 +1,97 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Profile struct {
+	Name     string
+	Age      int
+	Tags     []string `merge:"append"`
+	Emails   []string `merge:"replace"`
+	Scores   []int    `merge:"merge"`
+	Settings map[string]string
+	Limits   map[string]IDBlock
+	Main     *Simple
+	Sub      Simple `merge:"replace"`
+	private  string
+}
+
+func TestMerge(t *testing.T) {
+	dst := Profile{
+		Name:     "rvasily",
+		Age:      30,
+		Tags:     []string{"go"},
+		Emails:   []string{"old@mail.ru"},
+		Scores:   []int{1, 2, 3},
+		Settings: map[string]string{"lang": "ru", "theme": "dark"},
+		Main:     &Simple{ID: 42, Username: "rvasily"},
+		Sub:      Simple{ID: 1, Username: "sub"},
+		private:  "secret",
+	}
+	src := Profile{
+		Age:      31,
+		Tags:     []string{"reflect"},
+		Emails:   []string{"new@mail.ru"},
+		Scores:   []int{0, 20, 0, 40},
+		Settings: map[string]string{"lang": "en"},
+		Limits:   map[string]IDBlock{"a": {1}},
+		Main:     &Simple{Active: true},
+		Sub:      Simple{Active: true},
+		private:  "other",
+	}
+	expected := Profile{
+		Name:     "rvasily",
+		Age:      31,
+		Tags:     []string{"go", "reflect"},
+		Emails:   []string{"new@mail.ru"},
+		Scores:   []int{1, 20, 3, 40},
+		Settings: map[string]string{"lang": "en", "theme": "dark"},
+		Limits:   map[string]IDBlock{"a": {1}},
+		Main:     &Simple{ID: 42, Username: "rvasily", Active: true},
+		Sub:      Simple{Active: true},
+		private:  "secret",
+	}
+
+	if err := Merge(&dst, &src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, dst) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", dst, expected)
+	}
+
+	// zero src changes nothing
+	if err := Merge(&dst, Profile{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, dst) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", dst, expected)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	cases := []struct {
+		Dst interface{}
+		Src interface{}
+	}{
+		{Profile{}, Profile{}},
+		{&Profile{}, Simple{}},
+		{&struct {
+			Name string `merge:"append"`
+		}{}, struct {
+			Name string `merge:"append"`
+		}{"a"}},
+		{&struct {
+			Name string `merge:"sum"`
+		}{}, struct {
+			Name string `merge:"sum"`
+		}{"a"}},
+	}
+
+	for idx, item := range cases {
+		if err := Merge(item.Dst, item.Src); err == nil {
+			t.Errorf("[%d] expected error here", idx)
+		}
+	}
+}
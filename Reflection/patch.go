@@ -0,0 +1,276 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operation - one operation of JSON Patch (RFC 6902)
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MergePatch - applies JSON Merge Patch (RFC 7396) onto the struct dst points
+// to, patch is decoded json. dst is not changed if the result doesn't fit it
+func MergePatch(dst interface{}, patch interface{}) error {
+	return patchStruct(dst, func(doc interface{}) (interface{}, error) {
+		return mergePatch(doc, patch), nil
+	})
+}
+
+// ApplyPatch - applies JSON Patch (RFC 6902) onto the struct dst points to,
+// all the operations or none of them
+func ApplyPatch(dst interface{}, patch []Operation) error {
+	return patchStruct(dst, func(doc interface{}) (interface{}, error) {
+		for idx, op := range patch {
+			var err error
+			if doc, err = applyOperation(doc, op); err != nil {
+				return nil, fmt.Errorf("operation %d (%s %s): %v", idx, op.Op, op.Path, err)
+			}
+		}
+		return doc, nil
+	})
+}
+
+// patchStruct - s2i of dst, patch of the tree, i2s back into a copy of dst
+// with the exported fields reset; the copy replaces dst on success
+func patchStruct(dst interface{}, patch func(doc interface{}) (interface{}, error)) error {
+	dstPtr := reflect.ValueOf(dst)
+	if dstPtr.Kind() != reflect.Ptr || dstPtr.IsNil() {
+		return fmt.Errorf("Should be pointer in dst value")
+	}
+
+	doc, err := s2i(dst)
+	if err != nil {
+		return err
+	}
+	if doc, err = patch(doc); err != nil {
+		return err
+	}
+
+	typ := dstPtr.Type().Elem()
+	result := reflect.New(typ)
+	result.Elem().Set(dstPtr.Elem())
+	if typ.Kind() == reflect.Struct {
+		for _, field := range structFields(typ) {
+			if value, ok := fieldByIndex(result.Elem(), field.index); ok {
+				value.Set(reflect.Zero(value.Type()))
+			}
+		}
+	} else {
+		result.Elem().Set(reflect.Zero(typ))
+	}
+
+	if err := i2s(doc, result.Interface()); err != nil {
+		return err
+	}
+	dstPtr.Elem().Set(result.Elem())
+	return nil
+}
+
+func mergePatch(doc interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	docObj, ok := doc.(map[string]interface{})
+	if !ok {
+		docObj = map[string]interface{}{}
+	}
+
+	result := make(map[string]interface{}, len(docObj))
+	for key, value := range docObj {
+		result[key] = value
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = mergePatch(result[key], value)
+	}
+	return result
+}
+
+func applyOperation(doc interface{}, op Operation) (interface{}, error) {
+	// values in the tree are float64, map[string]interface{} and so on
+	value, err := s2i(op.Value)
+	if err != nil {
+		return nil, err
+	}
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, value)
+	case "remove":
+		return removeValue(doc, path)
+	case "replace":
+		if doc, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if len(path) > len(from) && reflect.DeepEqual(path[:len(from)], from) {
+				return nil, fmt.Errorf("can't move %s into itself", op.From)
+			}
+			if doc, err = removeValue(doc, from); err != nil {
+				return nil, err
+			}
+		} else if value, err = s2i(value); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "test":
+		current, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("test failed: %v != %v", current, value)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer - JSON Pointer (RFC 6901) to its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("bad pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex - index of the token in an array of the length, "-" is the end
+func arrayIndex(token string, length int, insert bool) (int, error) {
+	if token == "-" && insert {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("bad array index %q", token)
+	}
+	if i > length || (i == length && !insert) {
+		return 0, fmt.Errorf("index %d out of range", i)
+	}
+	return i, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("no %q", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, fmt.Errorf("no %q in %v", token, doc)
+		}
+	}
+	return doc, nil
+}
+
+// updateParent - the doc with the parent of the path replaced by what fn
+// makes of it and the last token
+func updateParent(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateParent(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		container[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(container), false)
+		container[i] = child
+	}
+	return doc, nil
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		}
+		return nil, fmt.Errorf("can't add %q to %v", token, parent)
+	})
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return updateParent(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("no %q", token)
+			}
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], container[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("no %q in %v", token, parent)
+	})
+}
@@ -0,0 +1,148 @@
+package convert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type Account struct {
+	Login   string            `json:"login"`
+	Name    string            `json:"name,omitempty"`
+	Age     int               `json:"age"`
+	Roles   []string          `json:"roles"`
+	Meta    map[string]string `json:"meta"`
+	Owner   *Simple           `json:"owner"`
+	version int
+}
+
+func testAccount() Account {
+	return Account{
+		Login:   "rvasily",
+		Name:    "Vasily",
+		Age:     30,
+		Roles:   []string{"user", "admin"},
+		Meta:    map[string]string{"lang": "ru"},
+		Owner:   &Simple{ID: 42},
+		version: 7,
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	cases := []struct {
+		Patch    string
+		Expected Account
+	}{
+		{
+			`{"age":31,"meta":{"theme":"dark","lang":null},"owner":{"Username":"boss"},"name":null}`,
+			Account{
+				Login: "rvasily", Age: 31, Roles: []string{"user", "admin"},
+				Meta: map[string]string{"theme": "dark"}, Owner: &Simple{ID: 42, Username: "boss"},
+				version: 7,
+			},
+		},
+		// arrays are replaced as a whole
+		{
+			`{"roles":["guest"],"owner":null}`,
+			Account{
+				Login: "rvasily", Name: "Vasily", Age: 30, Roles: []string{"guest"},
+				Meta: map[string]string{"lang": "ru"}, version: 7,
+			},
+		},
+	}
+
+	for idx, item := range cases {
+		var patch interface{}
+		json.Unmarshal([]byte(item.Patch), &patch)
+
+		result := testAccount()
+		if err := MergePatch(&result, patch); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+
+	// the result doesn't fit the struct - nothing is changed
+	var patch interface{}
+	json.Unmarshal([]byte(`{"age":"thirty","login":"new"}`), &patch)
+	result := testAccount()
+	if err := MergePatch(&result, patch); err == nil {
+		t.Errorf("expected error here")
+	}
+	if !reflect.DeepEqual(testAccount(), result) {
+		t.Errorf("dst is changed on error: %#v", result)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	cases := []struct {
+		Patch    string
+		Expected Account
+	}{
+		{
+			`[
+				{"op":"test","path":"/login","value":"rvasily"},
+				{"op":"replace","path":"/age","value":31},
+				{"op":"add","path":"/roles/1","value":"moderator"},
+				{"op":"add","path":"/roles/-","value":"root"},
+				{"op":"remove","path":"/roles/0"},
+				{"op":"add","path":"/meta/a~1b","value":"slash"},
+				{"op":"copy","from":"/login","path":"/name"},
+				{"op":"move","from":"/meta/lang","path":"/meta/language"}
+			]`,
+			Account{
+				Login: "rvasily", Name: "rvasily", Age: 31, Roles: []string{"moderator", "admin", "root"},
+				Meta: map[string]string{"language": "ru", "a/b": "slash"}, Owner: &Simple{ID: 42},
+				version: 7,
+			},
+		},
+		{
+			`[{"op":"remove","path":"/owner"},{"op":"replace","path":"/roles","value":[]}]`,
+			Account{
+				Login: "rvasily", Name: "Vasily", Age: 30, Roles: []string{},
+				Meta: map[string]string{"lang": "ru"}, version: 7,
+			},
+		},
+	}
+
+	for idx, item := range cases {
+		patch := []Operation{}
+		if err := json.Unmarshal([]byte(item.Patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+
+		result := testAccount()
+		if err := ApplyPatch(&result, patch); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	for idx, patch := range [][]Operation{
+		{{Op: "test", Path: "/login", Value: "other"}},
+		{{Op: "remove", Path: "/missing"}},
+		{{Op: "replace", Path: "/roles/5", Value: "x"}},
+		{{Op: "add", Path: "/roles/01", Value: "x"}},
+		{{Op: "move", From: "/meta", Path: "/meta/inner"}},
+		{{Op: "add", Path: "age", Value: 1}},
+		{{Op: "increment", Path: "/age"}},
+		// all or nothing
+		{{Op: "replace", Path: "/login", Value: "new"}, {Op: "replace", Path: "/age", Value: "old"}},
+	} {
+		result := testAccount()
+		if err := ApplyPatch(&result, patch); err == nil {
+			t.Errorf("[%d] expected error here", idx)
+		}
+		if !reflect.DeepEqual(testAccount(), result) {
+			t.Errorf("[%d] dst is changed on error: %#v", idx, result)
+		}
+	}
+}
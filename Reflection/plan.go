@@ -0,0 +1,429 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// copyFunc - compiled i2s for one destination type, json is already unwrapped
+// from interface{} and is not null
+type copyFunc func(json reflect.Value, struc reflect.Value, path string, d *decoder) error
+
+// plans - reflect.Type -> copyFunc with hooks, converters and null handling
+var plans sync.Map
+
+// planFor - the cached plan of the type, built on first use
+func planFor(typ reflect.Type) copyFunc {
+	if plan, ok := plans.Load(typ); ok {
+		return plan.(copyFunc)
+	}
+
+	// recursive types see this indirection until the plan is built
+	var (
+		wg   sync.WaitGroup
+		plan copyFunc
+	)
+	wg.Add(1)
+	indirect, loaded := plans.LoadOrStore(typ, copyFunc(func(json, struc reflect.Value, path string, d *decoder) error {
+		wg.Wait()
+		return plan(json, struc, path, d)
+	}))
+	if loaded {
+		return indirect.(copyFunc)
+	}
+
+	plan = withHooks(typ, withUnmarshaler(typ, withNull(typ, withConverters(typ, buildPlan(typ)))))
+	wg.Done()
+	plans.Store(typ, plan)
+	return plan
+}
+
+func withNull(typ reflect.Type, plan copyFunc) copyFunc {
+	nullable := false
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		nullable = true
+	}
+	zero := reflect.Zero(typ)
+
+	return func(json, struc reflect.Value, path string, d *decoder) error {
+		for json.Kind() == reflect.Interface {
+			json = json.Elem()
+		}
+		if json.IsValid() {
+			return plan(json, struc, path, d)
+		}
+		if !nullable {
+			return d.fail(path, json, struc, nil)
+		}
+		struc.Set(zero)
+		return nil
+	}
+}
+
+func buildPlan(typ reflect.Type) copyFunc {
+	switch typ {
+	case timeType:
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			// YAML and TOML have their own timestamps
+			if json.Type() == timeType {
+				struc.Set(json)
+				return nil
+			}
+			if json.Kind() != reflect.String {
+				return d.fail(path, json, struc, nil)
+			}
+			parsed, err := time.Parse(time.RFC3339Nano, json.String())
+			if err != nil {
+				return d.fail(path, json, struc, err)
+			}
+			struc.Set(reflect.ValueOf(parsed))
+			return nil
+		}
+
+	case durationType:
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if json.Kind() != reflect.String {
+				return d.fail(path, json, struc, nil)
+			}
+			parsed, err := time.ParseDuration(json.String())
+			if err != nil {
+				return d.fail(path, json, struc, err)
+			}
+			struc.SetInt(int64(parsed))
+			return nil
+		}
+	}
+
+	switch typ.Kind() {
+
+	case reflect.Ptr:
+		elemType := typ.Elem()
+		elem := planFor(elemType)
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if struc.IsNil() {
+				struc.Set(reflect.New(elemType))
+			}
+			return elem(json, struc.Elem(), path, d)
+		}
+
+	case reflect.Interface:
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if !json.Type().AssignableTo(typ) {
+				return d.fail(path, json, struc, nil)
+			}
+			struc.Set(json)
+			return nil
+		}
+
+	case reflect.Bool:
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if d.opts.WeaklyTyped && json.Kind() == reflect.String {
+				parsed, err := strconv.ParseBool(json.String())
+				if err != nil {
+					return d.fail(path, json, struc, err)
+				}
+				json = reflect.ValueOf(parsed)
+			}
+			if json.Kind() != reflect.Bool {
+				return d.fail(path, json, struc, nil)
+			}
+			struc.SetBool(json.Bool())
+			return nil
+		}
+
+	case reflect.String:
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if json.Kind() != reflect.String {
+				return d.fail(path, json, struc, nil)
+			}
+			struc.SetString(json.String())
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if d.opts.WeaklyTyped && json.Kind() == reflect.String {
+				parsed, err := parseNumber(json.String())
+				if err != nil {
+					return d.fail(path, json, struc, err)
+				}
+				json = parsed
+			}
+			if jsonKind(json) != "number" {
+				return d.fail(path, json, struc, nil)
+			}
+			if err := setNumber(json, struc); err != nil {
+				return d.fail(path, json, struc, err)
+			}
+			return nil
+		}
+
+	case reflect.Struct:
+		return structPlanFor(typ).copy
+
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return func(json, struc reflect.Value, path string, d *decoder) error {
+				return d.fail(path, json, struc, nil)
+			}
+		}
+		keyType, elemType := typ.Key(), typ.Elem()
+		elem := planFor(elemType)
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if json.Kind() != reflect.Map {
+				return d.fail(path, json, struc, nil)
+			}
+			if struc.IsNil() {
+				struc.Set(reflect.MakeMapWithSize(typ, json.Len()))
+			}
+
+			iter := json.MapRange()
+			for iter.Next() {
+				value := reflect.New(elemType).Elem()
+				if err := elem(iter.Value(), value, keyPath(path, iter.Key().String()), d); err != nil {
+					return err
+				}
+				struc.SetMapIndex(iter.Key().Convert(keyType), value)
+			}
+			return nil
+		}
+
+	case reflect.Slice, reflect.Array:
+		elem := planFor(typ.Elem())
+		isSlice := typ.Kind() == reflect.Slice
+		return func(json, struc reflect.Value, path string, d *decoder) error {
+			if d.opts.WeaklyTyped && json.Kind() != reflect.Slice && json.Kind() != reflect.Map {
+				json = reflect.ValueOf([]interface{}{json.Interface()})
+			}
+			if json.Kind() != reflect.Slice {
+				return d.fail(path, json, struc, nil)
+			}
+
+			if isSlice {
+				struc.Set(reflect.MakeSlice(typ, json.Len(), json.Len()))
+			} else if json.Len() != struc.Len() {
+				return d.fail(path, json, struc, fmt.Errorf("%d values for %s", json.Len(), typ))
+			}
+
+			for i := 0; i < json.Len(); i++ {
+				if err := elem(json.Index(i), struc.Index(i), indexPath(path, i), d); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	return func(json, struc reflect.Value, path string, d *decoder) error {
+		return d.fail(path, json, struc, fmt.Errorf("field type <%s> not implemented", typ))
+	}
+}
+
+// parseNumber - integers stay integers to keep all of their digits
+func parseNumber(str string) (reflect.Value, error) {
+	if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return reflect.ValueOf(i), nil
+	}
+	if u, err := strconv.ParseUint(str, 10, 64); err == nil {
+		return reflect.ValueOf(u), nil
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%q is not a number", str)
+	}
+	return reflect.ValueOf(f), nil
+}
+
+type planField struct {
+	fieldInfo
+	plan  copyFunc
+	rules *fieldRules
+}
+
+// fieldState - what decoding of the struct saw, for validation
+type fieldState struct {
+	present bool
+	badInt  bool
+}
+
+// structPlan - fields of the struct with their plans and rules
+type structPlan struct {
+	typ    reflect.Type
+	fields []planField
+	byName map[string]int
+	// byParam - fields by paramname of the apivalidator tag, for Validate
+	byParam   map[string]int
+	validated bool
+}
+
+// structPlans - reflect.Type -> *structPlan, shared by plans and DecodeJSON
+var structPlans sync.Map
+
+func structPlanFor(typ reflect.Type) *structPlan {
+	if plan, ok := structPlans.Load(typ); ok {
+		return plan.(*structPlan)
+	}
+	plan, _ := structPlans.LoadOrStore(typ, newStructPlan(typ))
+	return plan.(*structPlan)
+}
+
+func newStructPlan(typ reflect.Type) *structPlan {
+	infos := structFields(typ)
+	plan := &structPlan{
+		typ:    typ,
+		fields: make([]planField, len(infos)),
+		byName: make(map[string]int, len(infos)),
+	}
+	for i, info := range infos {
+		field := typ.FieldByIndex(info.index)
+		plan.fields[i] = planField{info, planFor(field.Type), parseRules(field)}
+		plan.byName[info.name] = i
+		plan.validated = plan.validated || plan.fields[i].rules != nil
+		if rules := plan.fields[i].rules; rules != nil && rules.param != "" {
+			if plan.byParam == nil {
+				plan.byParam = map[string]int{}
+			}
+			plan.byParam[rules.param] = i
+		}
+	}
+	return plan
+}
+
+// lookup - index of the field for the key, exact names first, -1 if none;
+// with Validate a field with paramname has no other key, as in the handlers
+// of Codegen
+func (plan *structPlan) lookup(key string, d *decoder) int {
+	validate := d.opts.Validate && plan.byParam != nil
+	if i, ok := plan.byParam[key]; ok && validate {
+		return i
+	}
+	i, ok := plan.byName[key]
+	if !ok {
+		i = -1
+		for j := range plan.fields {
+			if strings.EqualFold(plan.fields[j].name, key) {
+				i = j
+				break
+			}
+		}
+	}
+	if i != -1 && validate && plan.fields[i].rules != nil && plan.fields[i].rules.param != "" {
+		return -1
+	}
+	return i
+}
+
+// states - nil if there's nothing to validate
+func (plan *structPlan) states(d *decoder) []fieldState {
+	if !plan.validated || !d.opts.Validate {
+		return nil
+	}
+	return make([]fieldState, len(plan.fields))
+}
+
+func (plan *structPlan) unknown(struc reflect.Value, key string, value reflect.Value, path string, d *decoder) error {
+	if !d.opts.Strict {
+		return nil
+	}
+	err := fmt.Errorf("unknown field %q in %s", key, plan.typ)
+	return d.fail(fieldPath(path, key), value, struc, err)
+}
+
+func (plan *structPlan) assign(struc reflect.Value, key string, value reflect.Value, path string, d *decoder, states []fieldState) error {
+	i := plan.lookup(key, d)
+	if i == -1 {
+		return plan.unknown(struc, key, value, path, d)
+	}
+
+	field := &plan.fields[i]
+	strucField := allocField(struc, field.index)
+	if states == nil {
+		return field.plan(value, strucField, fieldPath(path, key), d)
+	}
+
+	states[i].present = true
+	if field.rules == nil || !isIntKind(strucField.Kind()) {
+		return field.plan(value, strucField, fieldPath(path, key), d)
+	}
+	// any failure of a validated int is "must be int", reported in order of fields
+	sub := &decoder{opts: d.opts}
+	sub.opts.CollectErrors = false
+	if field.plan(value, strucField, "", sub) != nil {
+		states[i].badInt = true
+	}
+	return nil
+}
+
+func (plan *structPlan) validate(struc reflect.Value, path string, d *decoder, states []fieldState) error {
+	for i := range plan.fields {
+		field := &plan.fields[i]
+		if field.rules == nil {
+			continue
+		}
+		strucField := allocField(struc, field.index)
+
+		err := field.rules.check(strucField, states[i].present)
+		if states[i].badInt {
+			err = field.rules.mustBeInt()
+		}
+		if err == nil {
+			continue
+		}
+		if err := d.fail(fieldPath(path, field.name), strucField, strucField, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (plan *structPlan) copy(json, struc reflect.Value, path string, d *decoder) error {
+	if json.Kind() != reflect.Map {
+		return d.fail(path, json, struc, nil)
+	}
+	states := plan.states(d)
+
+	// decoded json, no need for MapRange
+	if obj, ok := json.Interface().(map[string]interface{}); ok {
+		for key, value := range obj {
+			if err := plan.assign(struc, key, reflect.ValueOf(value), path, d, states); err != nil {
+				return err
+			}
+		}
+	} else {
+		iter := json.MapRange()
+		for iter.Next() {
+			if err := plan.assign(struc, iter.Key().String(), iter.Value(), path, d, states); err != nil {
+				return err
+			}
+		}
+	}
+
+	if states == nil {
+		return nil
+	}
+	return plan.validate(struc, path, d, states)
+}
+
+// allocField - the field by index, nil embedded pointers on the way are allocated
+func allocField(struc reflect.Value, index []int) reflect.Value {
+	if len(index) == 1 {
+		return struc.Field(index[0])
+	}
+	for _, i := range index {
+		if struc.Kind() == reflect.Ptr {
+			if struc.IsNil() {
+				struc.Set(reflect.New(struc.Type().Elem()))
+			}
+			struc = struc.Elem()
+		}
+		struc = struc.Field(i)
+	}
+	return struc
+}
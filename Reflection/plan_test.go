@@ -0,0 +1,335 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fieldByKey finds the field for the key, exact names first,
+// then case-insensitive. Nil embedded pointers on the way are allocated
+func fieldByKey(struc reflect.Value, key string) (reflect.Value, bool) {
+	fields := structFields(struc.Type())
+	found := -1
+
+	for i, field := range fields {
+		if field.name == key {
+			found = i
+			break
+		}
+		if found == -1 && strings.EqualFold(field.name, key) {
+			found = i
+		}
+	}
+	if found == -1 {
+		return reflect.Value{}, false
+	}
+
+	return allocField(struc, fields[found].index), true
+}
+
+// recursiveCopy - i2s without plans, every value is looked at from scratch;
+// the baseline of plans for plain i2s, it knows nothing of converters,
+// hooks, WeaklyTyped and Validate
+func recursiveCopy(json reflect.Value, struc reflect.Value, path string, d *decoder) error {
+	// values of decoded json are wrapped in interface{}
+	for json.Kind() == reflect.Interface {
+		json = json.Elem()
+	}
+
+	if !json.IsValid() {
+		switch struc.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			struc.Set(reflect.Zero(struc.Type()))
+			return nil
+		}
+		return d.fail(path, json, struc, nil)
+	}
+
+	switch struc.Type() {
+	case timeType:
+		if json.Kind() != reflect.String {
+			return d.fail(path, json, struc, nil)
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, json.String())
+		if err != nil {
+			return d.fail(path, json, struc, err)
+		}
+		struc.Set(reflect.ValueOf(parsed))
+		return nil
+
+	case durationType:
+		if json.Kind() != reflect.String {
+			return d.fail(path, json, struc, nil)
+		}
+		parsed, err := time.ParseDuration(json.String())
+		if err != nil {
+			return d.fail(path, json, struc, err)
+		}
+		struc.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch struc.Kind() {
+
+	case reflect.Ptr:
+		if struc.IsNil() {
+			struc.Set(reflect.New(struc.Type().Elem()))
+		}
+		return recursiveCopy(json, struc.Elem(), path, d)
+
+	case reflect.Interface:
+		if !json.Type().AssignableTo(struc.Type()) {
+			return d.fail(path, json, struc, nil)
+		}
+		struc.Set(json)
+
+	case reflect.Bool, reflect.String:
+		if json.Kind() != struc.Kind() {
+			return d.fail(path, json, struc, nil)
+		}
+		struc.Set(json.Convert(struc.Type()))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if jsonKind(json) != "number" {
+			return d.fail(path, json, struc, nil)
+		}
+		if err := setNumber(json, struc); err != nil {
+			return d.fail(path, json, struc, err)
+		}
+
+	case reflect.Struct:
+		if json.Kind() != reflect.Map {
+			return d.fail(path, json, struc, nil)
+		}
+
+		iter := json.MapRange()
+		for iter.Next() {
+			jsonKey := iter.Key().String()
+			strucField, ok := fieldByKey(struc, jsonKey)
+			if !ok {
+				if d.opts.Strict {
+					err := fmt.Errorf("unknown field %q in %s", jsonKey, struc.Type())
+					if err := d.fail(fieldPath(path, jsonKey), iter.Value(), struc, err); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			err := recursiveCopy(iter.Value(), strucField, fieldPath(path, jsonKey), d)
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if json.Kind() != reflect.Map || struc.Type().Key().Kind() != reflect.String {
+			return d.fail(path, json, struc, nil)
+		}
+		if struc.IsNil() {
+			struc.Set(reflect.MakeMapWithSize(struc.Type(), json.Len()))
+		}
+
+		iter := json.MapRange()
+		for iter.Next() {
+			elem := reflect.New(struc.Type().Elem()).Elem()
+			err := recursiveCopy(iter.Value(), elem, keyPath(path, iter.Key().String()), d)
+			if err != nil {
+				return err
+			}
+			struc.SetMapIndex(iter.Key().Convert(struc.Type().Key()), elem)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if json.Kind() != reflect.Slice {
+			return d.fail(path, json, struc, nil)
+		}
+
+		if struc.Kind() == reflect.Slice {
+			struc.Set(reflect.MakeSlice(
+				struc.Type(), json.Len(), json.Len(),
+			))
+		} else if json.Len() != struc.Len() {
+			err := fmt.Errorf("%d values for %s", json.Len(), struc.Type())
+			return d.fail(path, json, struc, err)
+		}
+
+		for i := 0; i < json.Len(); i++ {
+			err := recursiveCopy(
+				json.Index(i),
+				struc.Index(i), indexPath(path, i), d,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		err := fmt.Errorf("field type <%s> not implemented", struc.Type())
+		return d.fail(path, json, struc, err)
+	}
+
+	return nil
+}
+
+// decodeUncached - i2s the old way, through recursiveCopy
+func decodeUncached(data interface{}, out interface{}, opts Options) error {
+	d := &decoder{opts: opts}
+	if err := recursiveCopy(reflect.ValueOf(data), reflect.ValueOf(out).Elem(), "", d); err != nil {
+		return err
+	}
+	return d.err()
+}
+
+func TestPlanMatchesRecursiveCopy(t *testing.T) {
+	cases := []ErrorCase{
+		ErrorCase{&Complex{}, `{"SubSimple":{"ID":42,"Username":"rvasily","Active":true},"ManySimple":[{"ID":1},{"id":2}],"Blocks":[{"ID":3}]}`},
+		ErrorCase{&Complex{}, `{"ManySimple":[{"ID":1},{"Username":100500}]}`},
+		ErrorCase{&Numbers{}, `{"I8":-128,"U64":9007199254740992,"F32":1.5}`},
+		ErrorCase{&Numbers{}, `{"I8":128}`},
+		ErrorCase{&Pointers{}, `{"Name":"rvasily","Sub":{"ID":42},"Nested":{"ID":42},"Nil":null}`},
+		ErrorCase{&Containers{}, `{"ByName":{"admin":{"ID":42}},"Pair":[{"ID":1},{"ID":2}],"Any":[1,"two"]}`},
+		ErrorCase{&Containers{}, `{"Pair":[{"ID":1}]}`},
+		ErrorCase{&Embedded{}, `{"ID":42,"Created":"2019-12-31T23:59:59Z","Note":"vip","Timeout":"1.5s"}`},
+		ErrorCase{&Embedded{}, `{"Created":"yesterday"}`},
+		ErrorCase{&Tagged{}, `{"FULL_NAME":"Vasily Romanov","user_login":"rvasily","Secret":"123"}`},
+		ErrorCase{&Node{}, `{"Name":"a","Next":{"Name":"b","Next":{"Name":"c"}}}`},
+		ErrorCase{&map[int]int{}, `{"1":1}`},
+		ErrorCase{&[]*Simple{}, `[{"ID":1},null]`},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		for _, opts := range []Options{{}, {Strict: true, CollectErrors: true}} {
+			typ := reflect.TypeOf(item.Result).Elem()
+			planned, uncached := reflect.New(typ), reflect.New(typ)
+			plannedErr := Decode(tmpData, planned.Interface(), opts)
+			uncachedErr := decodeUncached(tmpData, uncached.Interface(), opts)
+
+			if !reflect.DeepEqual(planned.Interface(), uncached.Interface()) {
+				t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, planned.Interface(), uncached.Interface())
+			}
+			if (plannedErr == nil) != (uncachedErr == nil) ||
+				(plannedErr != nil && plannedErr.Error() != uncachedErr.Error()) {
+				t.Errorf("[%d] errors not match\nGot:\n%v\nExpected:\n%v", idx, plannedErr, uncachedErr)
+			}
+		}
+	}
+}
+
+type Tree struct {
+	Value    int
+	Children []Tree
+	Index    map[string]*Tree
+}
+
+func TestPlanConcurrent(t *testing.T) {
+	var tmpData interface{}
+	json.Unmarshal([]byte(`{"Value":1,"Children":[{"Value":2}],"Index":{"a":{"Value":3}}}`), &tmpData)
+	expected := Tree{Value: 1, Children: []Tree{{Value: 2}}, Index: map[string]*Tree{"a": {Value: 3}}}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := Tree{}
+			if err := i2s(tmpData, &result); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(expected, result) {
+				t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func benchData(b *testing.B) ([]byte, interface{}) {
+	smpl := Simple{ID: 42, Username: "rvasily", Active: true}
+	items := make([]Complex, 1000)
+	for i := range items {
+		items[i] = Complex{
+			SubSimple:  smpl,
+			ManySimple: []Simple{smpl, smpl, smpl},
+			Blocks:     []IDBlock{{i}, {i + 1}},
+		}
+	}
+	raw, err := json.Marshal(items)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var tmpData interface{}
+	json.Unmarshal(raw, &tmpData)
+	return raw, tmpData
+}
+
+func BenchmarkI2SPlan(b *testing.B) {
+	_, tmpData := benchData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := []Complex{}
+		if err := i2s(tmpData, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkI2SRecursiveCopy(b *testing.B) {
+	_, tmpData := benchData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := []Complex{}
+		if err := decodeUncached(tmpData, &result, Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONUnmarshal - encoding/json straight from bytes
+func BenchmarkJSONUnmarshal(b *testing.B) {
+	raw, _ := benchData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := []Complex{}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONUnmarshalI2S - encoding/json to interface{}, then i2s
+func BenchmarkJSONUnmarshalI2S(b *testing.B) {
+	raw, _ := benchData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var tmpData interface{}
+		json.Unmarshal(raw, &tmpData)
+		result := []Complex{}
+		if err := i2s(tmpData, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeJSON - tokens straight into the structs
+func BenchmarkDecodeJSON(b *testing.B) {
+	raw, _ := benchData(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result := []Complex{}
+		if err := DecodeJSON(bytes.NewReader(raw), &result, Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
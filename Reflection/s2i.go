@@ -0,0 +1,175 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// EncodeOptions - s2i behaviour, the zero value is plain s2i
+type EncodeOptions struct {
+	// OmitZero - skip zero struct fields, not only the omitempty ones
+	OmitZero bool
+	// CycleGuard - error on a pointer, map or slice containing itself
+	// instead of recursing forever
+	CycleGuard bool
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// s2i - struct to interface: the reverse of i2s, gives the same
+// map[string]interface{} / []interface{} / float64 / string / bool / nil
+// tree json.Unmarshal gives for the json of the value
+func s2i(in interface{}) (interface{}, error) {
+	return Encode(in, EncodeOptions{})
+}
+
+// Encode - s2i with options
+func Encode(in interface{}, opts EncodeOptions) (interface{}, error) {
+	var visited map[visit]bool
+	if opts.CycleGuard {
+		visited = map[visit]bool{}
+	}
+	return recursiveEncode(reflect.ValueOf(in), &opts, visited)
+}
+
+func recursiveEncode(val reflect.Value, opts *EncodeOptions, visited map[visit]bool) (interface{}, error) {
+	if !val.IsValid() {
+		return nil, nil
+	}
+
+	switch val.Type() {
+	case timeType:
+		return val.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case durationType:
+		return time.Duration(val.Int()).String(), nil
+	}
+
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if val.IsNil() {
+			return nil, nil
+		}
+		if visited != nil {
+			key := visit{val.Pointer(), val.Type()}
+			if visited[key] {
+				return nil, fmt.Errorf("Cycle via %s", val.Type())
+			}
+			visited[key] = true
+			defer delete(visited, key)
+		}
+	}
+
+	switch val.Kind() {
+
+	case reflect.Ptr, reflect.Interface:
+		return recursiveEncode(val.Elem(), opts, visited)
+
+	case reflect.Bool:
+		return val.Bool(), nil
+
+	case reflect.String:
+		return val.String(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), nil
+
+	case reflect.Struct:
+		result := map[string]interface{}{}
+		for _, field := range structFields(val.Type()) {
+			fieldVal, ok := fieldByIndex(val, field.index)
+			if !ok {
+				continue
+			}
+			if (opts.OmitZero && fieldVal.IsZero()) || (field.omitEmpty && isEmpty(fieldVal)) {
+				continue
+			}
+
+			encoded, err := recursiveEncode(fieldVal, opts, visited)
+			if err != nil {
+				return nil, err
+			}
+			result[field.name] = encoded
+		}
+		return result, nil
+
+	case reflect.Map:
+		result := make(map[string]interface{}, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			key, err := mapKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			encoded, err := recursiveEncode(iter.Value(), opts, visited)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = encoded
+		}
+		return result, nil
+
+	case reflect.Slice, reflect.Array:
+		result := make([]interface{}, val.Len())
+		for i := range result {
+			encoded, err := recursiveEncode(val.Index(i), opts, visited)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = encoded
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("Field type <%s> not implemented", val.Type())
+}
+
+// fieldByIndex - like reflect.Value.FieldByIndex, but false instead
+// of a panic on a nil embedded pointer
+func fieldByIndex(struc reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if struc.Kind() == reflect.Ptr {
+			if struc.IsNil() {
+				return reflect.Value{}, false
+			}
+			struc = struc.Elem()
+		}
+		struc = struc.Field(i)
+	}
+	return struc, true
+}
+
+func mapKey(key reflect.Value) (string, error) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("Map key type <%s> not implemented", key.Type())
+}
+
+// isEmpty - the omitempty rule of encoding/json
+func isEmpty(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return val.IsNil()
+	case reflect.Struct:
+		return false
+	}
+	return val.IsZero()
+}
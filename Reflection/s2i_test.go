@@ -0,0 +1,153 @@
+package convert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestS2I(t *testing.T) {
+	smpl := Simple{
+		ID:       42,
+		Username: "rvasily",
+		Active:   true,
+	}
+	cases := []struct {
+		Value    interface{}
+		Expected interface{}
+	}{
+		{Value: &smpl},
+		{Value: &Complex{
+			SubSimple:  smpl,
+			ManySimple: []Simple{smpl, smpl},
+			Blocks:     []IDBlock{IDBlock{42}, IDBlock{42}},
+		}},
+		{Value: []Simple{smpl, smpl}},
+		{Value: map[string][]int{"a": {1, 2}, "b": nil}},
+		{Value: map[int]bool{1: true}},
+		// i2s tags win over json ones, omitempty is honoured
+		{
+			&Tagged{Login: "rvasily", Secret: "123", Skipped: true},
+			map[string]interface{}{"user_login": "rvasily", "Age": 0.0},
+		},
+		// durations are strings, like i2s expects them
+		{
+			&Embedded{Base: Base{ID: 42, Created: time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC)}, Timeout: time.Second},
+			map[string]interface{}{"ID": 42.0, "Created": "2019-12-31T23:59:59Z", "Username": "", "Timeout": "1s"},
+		},
+	}
+
+	for idx, item := range cases {
+		// without explicit expectation s2i gives the same as json.Marshal + json.Unmarshal
+		expected := item.Expected
+		if expected == nil {
+			jsonRaw, _ := json.Marshal(item.Value)
+			json.Unmarshal(jsonRaw, &expected)
+		}
+
+		result, err := s2i(item.Value)
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, expected)
+		}
+	}
+}
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+func TestS2IOptions(t *testing.T) {
+	result, err := Encode(&Simple{ID: 42}, EncodeOptions{OmitZero: true})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"ID": 42.0}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", result, expected)
+	}
+
+	loop := &Node{Name: "a", Next: &Node{Name: "b"}}
+	loop.Next.Next = loop
+	if _, err := Encode(loop, EncodeOptions{CycleGuard: true}); err == nil {
+		t.Errorf("expected cycle error")
+	}
+
+	self := map[string]interface{}{}
+	self["self"] = self
+	if _, err := Encode(self, EncodeOptions{CycleGuard: true}); err == nil {
+		t.Errorf("expected cycle error")
+	}
+
+	// the same pointer twice is not a cycle
+	shared := &Simple{ID: 1}
+	if _, err := Encode([]*Simple{shared, shared}, EncodeOptions{CycleGuard: true}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := s2i(map[bool]int{true: 1}); err == nil {
+		t.Errorf("expected error for bool map keys")
+	}
+	if _, err := s2i(struct{ C chan int }{}); err == nil {
+		t.Errorf("expected error for channels")
+	}
+}
+
+// Inner - small integers only, bigger ones don't survive float64
+type Inner struct {
+	Code  int16
+	Label string
+}
+
+type RoundTrip struct {
+	ID      int32
+	Name    string
+	Active  bool
+	Score   float64
+	Ratio   float32
+	Small   uint8
+	Tags    []string
+	Counts  map[string]int16
+	Best    *Inner
+	Grid    [3]int8
+	Sub     Inner
+	Comment *string `json:"comment,omitempty"`
+}
+
+func TestS2IRoundTrip(t *testing.T) {
+	for _, opts := range []EncodeOptions{{}, {OmitZero: true, CycleGuard: true}} {
+		roundTrip := func(in RoundTrip) bool {
+			tree, err := Encode(in, opts)
+			if err != nil {
+				t.Logf("unexpected error: %v", err)
+				return false
+			}
+			out := RoundTrip{}
+			if err := i2s(tree, &out); err != nil {
+				t.Logf("unexpected error: %v", err)
+				return false
+			}
+			return reflect.DeepEqual(normalize(in), normalize(out))
+		}
+
+		if err := quick.Check(roundTrip, nil); err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+}
+
+// normalize - nil and empty slices and maps are the same after the round trip
+func normalize(r RoundTrip) RoundTrip {
+	if len(r.Tags) == 0 {
+		r.Tags = nil
+	}
+	if len(r.Counts) == 0 {
+		r.Counts = nil
+	}
+	return r
+}
@@ -0,0 +1,85 @@
+package convert
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeValues - i2s from query or form parameters: a key with one value is
+// a string, with more of them a list. Always WeaklyTyped
+func DecodeValues(values url.Values, out interface{}, opts Options) error {
+	tree := make(map[string]interface{}, len(values))
+	for key, vals := range values {
+		if len(vals) == 1 {
+			tree[key] = vals[0]
+			continue
+		}
+		list := make([]interface{}, len(vals))
+		for i, val := range vals {
+			list[i] = val
+		}
+		tree[key] = list
+	}
+
+	opts.WeaklyTyped = true
+	return Decode(tree, out, opts)
+}
+
+// DecodeEnv - i2s from environment variables with the prefix and "_", the
+// rest of the name is the key: with prefix APP, APP_LOGIN goes to login,
+// APP_DB__HOST goes to host of db and APPLE_LOGIN is not there. Always
+// WeaklyTyped
+func DecodeEnv(prefix string, out interface{}, opts Options) error {
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "_") + "_"
+	}
+	tree := map[string]interface{}{}
+	for _, env := range os.Environ() {
+		eq := strings.Index(env, "=")
+		if eq == -1 || !strings.HasPrefix(env[:eq], prefix) {
+			continue
+		}
+		name := env[len(prefix):eq]
+		if name == "" {
+			continue
+		}
+
+		keys := strings.Split(name, "__")
+		obj := tree
+		for _, key := range keys[:len(keys)-1] {
+			inner, ok := obj[key].(map[string]interface{})
+			if !ok {
+				inner = map[string]interface{}{}
+				obj[key] = inner
+			}
+			obj = inner
+		}
+		obj[keys[len(keys)-1]] = env[eq+1:]
+	}
+
+	opts.WeaklyTyped = true
+	return Decode(tree, out, opts)
+}
+
+// DecodeYAML - i2s from a YAML document
+func DecodeYAML(r io.Reader, out interface{}, opts Options) error {
+	var tree interface{}
+	if err := yaml.NewDecoder(r).Decode(&tree); err != nil && err != io.EOF {
+		return err
+	}
+	return Decode(tree, out, opts)
+}
+
+// DecodeTOML - i2s from a TOML document
+func DecodeTOML(r io.Reader, out interface{}, opts Options) error {
+	tree := map[string]interface{}{}
+	if _, err := toml.NewDecoder(r).Decode(&tree); err != nil {
+		return err
+	}
+	return Decode(tree, out, opts)
+}
@@ -0,0 +1,256 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Config struct {
+	Name    string        `json:"name"`
+	Port    int           `json:"port"`
+	Debug   bool          `json:"debug"`
+	Ratio   float64       `json:"ratio"`
+	Hosts   []string      `json:"hosts"`
+	Timeout time.Duration `json:"timeout"`
+	Started time.Time     `json:"started"`
+	DB      struct {
+		Host string `json:"host"`
+		Port uint16 `json:"port"`
+	} `json:"db"`
+}
+
+func expectedConfig() Config {
+	cfg := Config{
+		Name:    "api",
+		Port:    8080,
+		Debug:   true,
+		Ratio:   0.5,
+		Hosts:   []string{"a", "b"},
+		Timeout: 3 * time.Second,
+		Started: time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC),
+	}
+	cfg.DB.Host = "localhost"
+	cfg.DB.Port = 5432
+	return cfg
+}
+
+func TestDecodeValues(t *testing.T) {
+	cases := []struct {
+		Query    string
+		Expected CreateParams
+		Error    string
+	}{
+		// queries of Codegen/main_test.go
+		{
+			"login=mr.moderator&age=32&status=moderator&full_name=Ivan_Ivanov",
+			CreateParams{"mr.moderator", "Ivan_Ivanov", "moderator", 32}, "",
+		},
+		{"&age=32&status=moderator&full_name=Ivan_Ivanov", CreateParams{}, "login must me not empty"},
+		{"login=new_moderator&age=ten&status=moderator", CreateParams{}, "age must be int"},
+		{"login=new_moderator&age=-1&status=moderator", CreateParams{}, "age must be >= 0"},
+		{"login=new_moderator&age=32&status=adm", CreateParams{}, "status must be one of [user, moderator, admin]"},
+		{
+			"login=new_moderator3&age=32&full_name=Ivan_Ivanov",
+			CreateParams{"new_moderator3", "Ivan_Ivanov", "user", 32}, "",
+		},
+	}
+
+	for idx, item := range cases {
+		values, _ := url.ParseQuery(item.Query)
+		result := CreateParams{}
+		err := DecodeValues(values, &result, Options{Validate: true})
+		if item.Error != "" {
+			if err == nil || err.Error() != item.Error {
+				t.Errorf("[%d] expected error %q, got %v", idx, item.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+
+	// repeated keys are lists, a single value is a list of one
+	values, _ := url.ParseQuery("hosts=a&hosts=b&debug=true&ratio=0.5")
+	result := Config{}
+	if err := DecodeValues(values, &result, Options{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual([]string{"a", "b"}, result.Hosts) || !result.Debug || result.Ratio != 0.5 {
+		t.Errorf("results not match\nGot:\n%#v", result)
+	}
+	values, _ = url.ParseQuery("hosts=a")
+	if err := DecodeValues(values, &result, Options{}); err != nil || !reflect.DeepEqual([]string{"a"}, result.Hosts) {
+		t.Errorf("results not match\nGot:\n%#v\nerror: %v", result.Hosts, err)
+	}
+}
+
+func TestDecodeEnv(t *testing.T) {
+	for key, value := range map[string]string{
+		"APP_NAME":     "api",
+		"APP_PORT":     "8080",
+		"APP_DEBUG":    "true",
+		"APP_RATIO":    "0.5",
+		"APP_HOSTS":    "a",
+		"APP_TIMEOUT":  "3s",
+		"APP_STARTED":  "2019-12-31T23:59:59Z",
+		"APP_DB__HOST": "localhost",
+		"APP_DB__PORT": "5432",
+		"OTHER_NAME":   "other",
+	} {
+		t.Setenv(key, value)
+	}
+
+	expected := expectedConfig()
+	expected.Hosts = []string{"a"}
+	result := Config{}
+	if err := DecodeEnv("APP", &result, Options{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if diff := Diff(expected, result); len(diff) != 0 {
+		t.Errorf("results not match\n%v", diff)
+	}
+
+	t.Setenv("APP_DB__PORT", "70000")
+	var fieldErr *FieldError
+	if err := DecodeEnv("APP", &result, Options{}); !errors.As(err, &fieldErr) || fieldErr.Path != "DB.PORT" {
+		t.Errorf("expected FieldError for DB.PORT, got %v", err)
+	}
+
+	// only SVC_ ones, not the ones that just start with SVC
+	t.Setenv("SVC_NAME", "api")
+	t.Setenv("SVCX_PORT", "1")
+	t.Setenv("SVCPORT", "2")
+	for _, prefix := range []string{"SVC", "SVC_"} {
+		svc := Config{}
+		if err := DecodeEnv(prefix, &svc, Options{}); err != nil || svc.Name != "api" || svc.Port != 0 {
+			t.Errorf("[%s] results not match\nGot:\n%+v %v\nExpected:\nName api, Port 0", prefix, svc, err)
+		}
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	doc := `
+name: api
+port: 8080
+debug: true
+ratio: 0.5
+hosts: [a, b]
+timeout: 3s
+started: 2019-12-31T23:59:59Z
+db:
+  host: localhost
+  port: 5432
+`
+	result := Config{}
+	if err := DecodeYAML(strings.NewReader(doc), &result, Options{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if diff := Diff(expectedConfig(), result); len(diff) != 0 {
+		t.Errorf("results not match\n%v", diff)
+	}
+
+	if err := DecodeYAML(strings.NewReader("port: [1]"), &result, Options{}); err == nil {
+		t.Errorf("expected error here")
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	doc := `
+name = "api"
+port = 8080
+debug = true
+ratio = 0.5
+hosts = ["a", "b"]
+timeout = "3s"
+started = 2019-12-31T23:59:59Z
+
+[db]
+host = "localhost"
+port = 5432
+`
+	result := Config{}
+	if err := DecodeTOML(strings.NewReader(doc), &result, Options{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if diff := Diff(expectedConfig(), result); len(diff) != 0 {
+		t.Errorf("results not match\n%v", diff)
+	}
+
+	if err := DecodeTOML(strings.NewReader(`name = 1`), &result, Options{}); err == nil {
+		t.Errorf("expected error here")
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	cases := []struct {
+		Result   interface{}
+		JsonData string
+		Opts     Options
+	}{
+		{&Complex{}, `{"SubSimple":{"ID":42,"Username":"rvasily","Active":true},"ManySimple":[{"ID":1},{"id":2}],"Blocks":[{"ID":3}]}`, Options{}},
+		{&Pointers{}, `{"Name":"rvasily","Sub":{"ID":42},"Nested":{"ID":42},"Nil":null}`, Options{}},
+		{&Containers{}, `{"ByName":{"admin":{"ID":42}},"Pair":[{"ID":1},{"ID":2}],"Any":{"key":[1,"two",null]}}`, Options{}},
+		{&Embedded{}, `{"ID":42,"Created":"2019-12-31T23:59:59Z","Note":"vip","Timeout":"1.5s"}`, Options{}},
+		{&Event{}, `{"ID":"123e4567-e89b-12d3-a456-426614174000","Level":"warn","Price":"10.5","Tags":["info"]}`, Options{}},
+		{&Tree{}, `{"Value":1,"Children":[{"Value":2,"Children":[]}],"Index":{"a":{"Value":3}}}`, Options{}},
+		{&[]*Simple{}, `[{"ID":1},null]`, Options{}},
+		// errors are the same too
+		{&Complex{}, `{"ManySimple":[{"ID":1},{"Username":100500}]}`, Options{}},
+		{&Containers{}, `{"Pair":[{"ID":1}]}`, Options{}},
+		{&Tagged{}, `{"full_name":"Vasily","unknown":{"a":[1]},"Age":"42"}`, Options{Strict: true, CollectErrors: true}},
+		{&Team{}, `{"Members":[{"login":"short","age":{"a":1},"status":"adm"},{}]}`, Options{Validate: true, CollectErrors: true}},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		typ := reflect.TypeOf(item.Result).Elem()
+		streamed, expected := reflect.New(typ), reflect.New(typ)
+		streamedErr := DecodeJSON(strings.NewReader(item.JsonData), streamed.Interface(), item.Opts)
+		expectedErr := Decode(tmpData, expected.Interface(), item.Opts)
+
+		if diff := Diff(expected.Interface(), streamed.Interface()); len(diff) != 0 {
+			t.Errorf("[%d] results not match\n%v", idx, diff)
+		}
+		if !sameErrors(streamedErr, expectedErr) {
+			t.Errorf("[%d] errors not match\nGot:\n%v\nExpected:\n%v", idx, streamedErr, expectedErr)
+		}
+	}
+
+	if err := DecodeJSON(strings.NewReader(`{"ID":`), &Simple{}, Options{}); err == nil {
+		t.Errorf("expected error for broken json")
+	}
+}
+
+// sameErrors - the same errors, maybe in other order as map keys go
+func sameErrors(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	linesA := strings.Split(a.Error(), "\n")
+	linesB := strings.Split(b.Error(), "\n")
+	count := map[string]int{}
+	for _, line := range linesA {
+		count[line]++
+	}
+	for _, line := range linesB {
+		count[line]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// DecodeJSON - i2s straight from json tokens: structs, maps and slices are
+// filled as the tokens come, only values for types with hooks, converters or
+// UnmarshalI2S are collected into a tree first
+func DecodeJSON(r io.Reader, out interface{}, opts Options) error {
+	strucPtr := reflect.ValueOf(out)
+	if strucPtr.Kind() != reflect.Ptr || strucPtr.IsNil() {
+		return fmt.Errorf("Should be pointer in out value")
+	}
+
+	s := &streamer{dec: json.NewDecoder(r), d: &decoder{opts: opts}}
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if err := s.value(tok, strucPtr.Elem(), ""); err != nil {
+		return err
+	}
+	return s.d.err()
+}
+
+type streamer struct {
+	dec *json.Decoder
+	d   *decoder
+}
+
+// streamable - the type, and the types its pointers point to, have
+// nothing that needs the whole value at once
+func streamable(typ reflect.Type) bool {
+	if registered, _ := hooks.Load().([]Hook); len(registered) > 0 {
+		return false
+	}
+	for {
+		if len(typeConverters(typ)) > 0 || (typ.Kind() != reflect.Interface && reflect.PtrTo(typ).Implements(unmarshalerType)) {
+			return false
+		}
+		if typ.Kind() != reflect.Ptr {
+			break
+		}
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		return typ != timeType
+	case reflect.Map:
+		return typ.Key().Kind() == reflect.String
+	case reflect.Slice:
+		return true
+	}
+	return false
+}
+
+func (s *streamer) value(tok json.Token, struc reflect.Value, path string) error {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return planFor(struc.Type())(reflect.ValueOf(tok), struc, path, s.d)
+	}
+
+	kind := struc.Type()
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+	isObject := delim == '{' && kind.Kind() != reflect.Slice
+	isArray := delim == '[' && kind.Kind() == reflect.Slice
+	if !streamable(struc.Type()) || !(isObject || isArray) {
+		tree, err := s.tree(tok)
+		if err != nil {
+			return err
+		}
+		return planFor(struc.Type())(reflect.ValueOf(tree), struc, path, s.d)
+	}
+
+	for struc.Kind() == reflect.Ptr {
+		if struc.IsNil() {
+			struc.Set(reflect.New(struc.Type().Elem()))
+		}
+		struc = struc.Elem()
+	}
+
+	switch {
+	case isArray:
+		return s.slice(struc, path)
+	case struc.Kind() == reflect.Map:
+		return s.mapObject(struc, path)
+	}
+	return s.object(struc, path)
+}
+
+func (s *streamer) object(struc reflect.Value, path string) error {
+	plan := structPlanFor(struc.Type())
+	states := plan.states(s.d)
+
+	for s.dec.More() {
+		key, tok, err := s.member()
+		if err != nil {
+			return err
+		}
+
+		i := plan.lookup(key, s.d)
+		_, isDelim := tok.(json.Delim)
+		// a validated int gets "must be int" for anything, the struct plan knows how
+		if !isDelim || i == -1 || (states != nil && plan.fields[i].rules != nil) {
+			tree, err := s.tree(tok)
+			if err != nil {
+				return err
+			}
+			if err := plan.assign(struc, key, reflect.ValueOf(tree), path, s.d, states); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if states != nil {
+			states[i].present = true
+		}
+		field := allocField(struc, plan.fields[i].index)
+		if err := s.value(tok, field, fieldPath(path, key)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+
+	if states == nil {
+		return nil
+	}
+	return plan.validate(struc, path, s.d, states)
+}
+
+func (s *streamer) mapObject(struc reflect.Value, path string) error {
+	typ := struc.Type()
+	if struc.IsNil() {
+		struc.Set(reflect.MakeMap(typ))
+	}
+
+	for s.dec.More() {
+		key, tok, err := s.member()
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(typ.Elem()).Elem()
+		if err := s.value(tok, elem, keyPath(path, key)); err != nil {
+			return err
+		}
+		struc.SetMapIndex(reflect.ValueOf(key).Convert(typ.Key()), elem)
+	}
+	_, err := s.dec.Token()
+	return err
+}
+
+func (s *streamer) slice(struc reflect.Value, path string) error {
+	typ := struc.Type()
+	struc.Set(reflect.MakeSlice(typ, 0, 0))
+
+	for i := 0; s.dec.More(); i++ {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		struc.Set(reflect.Append(struc, reflect.Zero(typ.Elem())))
+		if err := s.value(tok, struc.Index(i), indexPath(path, i)); err != nil {
+			return err
+		}
+	}
+	_, err := s.dec.Token()
+	return err
+}
+
+// member - the key and the first token of the value
+func (s *streamer) member() (string, json.Token, error) {
+	keyTok, err := s.dec.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	key, ok := keyTok.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected %v instead of a key", keyTok)
+	}
+	tok, err := s.dec.Token()
+	return key, tok, err
+}
+
+// tree - the value starting with the token as json.Unmarshal would give it
+func (s *streamer) tree(tok json.Token) (interface{}, error) {
+	switch tok {
+	case json.Delim('{'):
+		obj := map[string]interface{}{}
+		for s.dec.More() {
+			key, tok, err := s.member()
+			if err != nil {
+				return nil, err
+			}
+			if obj[key], err = s.tree(tok); err != nil {
+				return nil, err
+			}
+		}
+		_, err := s.dec.Token()
+		return obj, err
+
+	case json.Delim('['):
+		list := []interface{}{}
+		for s.dec.More() {
+			tok, err := s.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			item, err := s.tree(tok)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		_, err := s.dec.Token()
+		return list, err
+	}
+
+	if delim, ok := tok.(json.Delim); ok {
+		return nil, fmt.Errorf("unexpected %v", delim)
+	}
+	return tok, nil
+}
@@ -0,0 +1,70 @@
+package convert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type Tagged struct {
+	FullName string `json:"full_name,omitempty"`
+	Login    string `json:"login" i2s:"user_login"`
+	Age      int
+	Secret   string `json:"-"`
+	Skipped  bool   `i2s:"-" json:"skipped"`
+	private  string
+}
+
+func TestTags(t *testing.T) {
+	cases := []struct {
+		JsonData string
+		Expected Tagged
+	}{
+		{
+			`{"full_name":"Vasily Romanov","user_login":"rvasily","Age":42}`,
+			Tagged{FullName: "Vasily Romanov", Login: "rvasily", Age: 42},
+		},
+		// case doesn't matter when there is no exact match
+		{
+			`{"FULL_NAME":"Vasily Romanov","age":42}`,
+			Tagged{FullName: "Vasily Romanov", Age: 42},
+		},
+		// json name is overridden by i2s tag, "-" fields and unknown keys are skipped
+		{
+			`{"login":"rvasily","Secret":"123","skipped":true,"Skipped":true,"unknown":1}`,
+			Tagged{},
+		},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		result := Tagged{}
+		if err := i2s(tmpData, &result); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	for idx, jsonData := range []string{
+		`{"full_name":"Vasily Romanov","unknown":1}`,
+		`{"Secret":"123"}`,
+		`{"private":"123"}`,
+	} {
+		var tmpData interface{}
+		json.Unmarshal([]byte(jsonData), &tmpData)
+
+		if err := Decode(tmpData, &Tagged{}, Options{Strict: true}); err == nil {
+			t.Errorf("[%d] expected error here", idx)
+		}
+		if err := Decode(tmpData, &Tagged{}, Options{}); err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+	}
+}
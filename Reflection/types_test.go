@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Numbers struct {
+	I8  int8
+	I16 int16
+	I32 int32
+	I64 int64
+	U   uint
+	U8  uint8
+	U16 uint16
+	U32 uint32
+	U64 uint64
+	F32 float32
+	F64 float64
+}
+
+type Pointers struct {
+	Name   *string
+	Sub    *Simple
+	Nested **IDBlock
+	Nil    *Simple
+}
+
+type Containers struct {
+	ByName map[string]Simple
+	Counts map[string]int
+	Pair   [2]IDBlock
+	Any    interface{}
+	Items  []interface{}
+}
+
+type Base struct {
+	ID      int
+	Created time.Time
+}
+
+type Extra struct {
+	Note string
+}
+
+type Embedded struct {
+	Base
+	*Extra
+	Username string
+	Timeout  time.Duration
+}
+
+type TypeCase struct {
+	Expected interface{}
+	JsonData string
+}
+
+func TestTypes(t *testing.T) {
+	name := "rvasily"
+	block := &IDBlock{42}
+	created := time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC)
+
+	cases := []TypeCase{
+		TypeCase{
+			&Numbers{-128, -32768, -2147483648, -9007199254740992, 1, 255, 65535, 4294967295, 9007199254740992, 1.5, 0.1},
+			`{"I8":-128,"I16":-32768,"I32":-2147483648,"I64":-9007199254740992,"U":1,"U8":255,"U16":65535,` +
+				`"U32":4294967295,"U64":9007199254740992,"F32":1.5,"F64":0.1}`,
+		},
+		TypeCase{
+			&Pointers{Name: &name, Sub: &Simple{42, "rvasily", true}, Nested: &block},
+			`{"Name":"rvasily","Sub":{"ID":42,"Username":"rvasily","Active":true},"Nested":{"ID":42},"Nil":null}`,
+		},
+		TypeCase{
+			&Containers{
+				ByName: map[string]Simple{"admin": {42, "rvasily", true}},
+				Counts: map[string]int{"a": 1, "b": 2},
+				Pair:   [2]IDBlock{{1}, {2}},
+				Any:    map[string]interface{}{"key": []interface{}{1.0, "two", nil}},
+				Items:  []interface{}{true, 1.5, "str"},
+			},
+			`{"ByName":{"admin":{"ID":42,"Username":"rvasily","Active":true}},"Counts":{"a":1,"b":2},` +
+				`"Pair":[{"ID":1},{"ID":2}],"Any":{"key":[1,"two",null]},"Items":[true,1.5,"str"]}`,
+		},
+		TypeCase{
+			&Embedded{Base{42, created}, &Extra{"vip"}, "rvasily", 1500 * time.Millisecond},
+			`{"ID":42,"Created":"2019-12-31T23:59:59Z","Note":"vip","Username":"rvasily","Timeout":"1.5s"}`,
+		},
+		TypeCase{
+			&[]*Simple{&Simple{ID: 1}, nil},
+			`[{"ID":1},null]`,
+		},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		result := reflect.New(reflect.TypeOf(item.Expected).Elem())
+		err := i2s(tmpData, result.Interface())
+
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+		}
+		if !reflect.DeepEqual(item.Expected, result.Interface()) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result.Interface(), item.Expected)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	cases := []ErrorCase{
+		// overflows and fractions
+		ErrorCase{&Numbers{}, `{"I8":128}`},
+		ErrorCase{&Numbers{}, `{"U8":-1}`},
+		ErrorCase{&Numbers{}, `{"U":1.5}`},
+		ErrorCase{&Numbers{}, `{"I64":1e19}`},
+		ErrorCase{&Numbers{}, `{"F32":1e39}`},
+		// null only for pointers, maps, slices and interfaces
+		ErrorCase{&Numbers{}, `{"I8":null}`},
+		// map keys and values
+		ErrorCase{&map[int]int{}, `{"1":1}`},
+		ErrorCase{&Containers{}, `{"Counts":{"a":"1"}}`},
+		// array length
+		ErrorCase{&Containers{}, `{"Pair":[{"ID":1}]}`},
+		// time and duration are strings in their own format
+		ErrorCase{&Embedded{}, `{"Created":"yesterday"}`},
+		ErrorCase{&Embedded{}, `{"Timeout":1500}`},
+		// nil pointer has nowhere to write
+		ErrorCase{(*Simple)(nil), `{"ID":42}`},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		if err := i2s(tmpData, item.Result); err == nil {
+			t.Errorf("[%d] expected error here", idx)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ValidationError - a broken apivalidator rule, the message is the same
+// the handlers generated by Codegen give
+type ValidationError struct {
+	// Field - lowercased name of the struct field
+	Field string
+	// Rule - required, min, max, enum or int
+	Rule    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// fieldRules - parsed apivalidator tag:
+// required, min=N, max=N, enum=a|b|c, default=V, paramname=key
+type fieldRules struct {
+	name       string
+	param      string
+	required   bool
+	hasMin     bool
+	min        int
+	hasMax     bool
+	max        int
+	enum       []string
+	hasDefault bool
+	def        string
+	err        error
+}
+
+func validatorTag(field reflect.StructField) (map[string]string, bool) {
+	tag, ok := field.Tag.Lookup("apivalidator")
+	if !ok {
+		return nil, false
+	}
+	vals := map[string]string{}
+	for _, val := range strings.Split(tag, ",") {
+		if i := strings.Index(val, "="); i == -1 {
+			vals[val] = ""
+		} else {
+			vals[val[:i]] = val[i+1:]
+		}
+	}
+	return vals, true
+}
+
+// parseRules - nil for fields without the tag
+func parseRules(field reflect.StructField) *fieldRules {
+	vals, ok := validatorTag(field)
+	if !ok {
+		return nil
+	}
+
+	rules := &fieldRules{name: strings.ToLower(field.Name), param: vals["paramname"]}
+	_, rules.required = vals["required"]
+	rules.def, rules.hasDefault = vals["default"]
+	if enum, ok := vals["enum"]; ok {
+		rules.enum = strings.Split(enum, "|")
+	}
+	for _, bound := range []struct {
+		key string
+		has *bool
+		val *int
+	}{{"min", &rules.hasMin, &rules.min}, {"max", &rules.hasMax, &rules.max}} {
+		raw, ok := vals[bound.key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			rules.err = fmt.Errorf("bad %s=%s in apivalidator tag of %s", bound.key, raw, field.Name)
+			continue
+		}
+		*bound.has, *bound.val = true, n
+	}
+	return rules
+}
+
+func (r *fieldRules) fail(rule, format string, args ...interface{}) error {
+	return &ValidationError{
+		Field:   r.name,
+		Rule:    rule,
+		Message: r.name + " " + fmt.Sprintf(format, args...),
+	}
+}
+
+// mustBeInt - integer fields that got no integer, missing ones included
+func (r *fieldRules) mustBeInt() error {
+	return r.fail("int", "must be int")
+}
+
+// check applies the default and the rules in the order of the generated code
+func (r *fieldRules) check(val reflect.Value, present bool) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	switch val.Kind() {
+
+	case reflect.String:
+		if r.hasDefault && val.String() == "" {
+			val.SetString(r.def)
+		}
+		str := val.String()
+		if r.required && str == "" {
+			return r.fail("required", "must me not empty")
+		}
+		if err := r.checkEnum(str); err != nil {
+			return err
+		}
+		if r.hasMin && len(str) < r.min {
+			return r.fail("min", "len must be >= %d", r.min)
+		}
+		if r.hasMax && len(str) > r.max {
+			return r.fail("max", "len must be <= %d", r.max)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !present {
+			if !r.hasDefault {
+				return r.mustBeInt()
+			}
+			n, err := strconv.ParseInt(r.def, 10, 64)
+			if err != nil || val.OverflowInt(n) {
+				return r.mustBeInt()
+			}
+			val.SetInt(n)
+		}
+		n := val.Int()
+		if err := r.checkEnum(strconv.FormatInt(n, 10)); err != nil {
+			return err
+		}
+		if r.hasMin && n < int64(r.min) {
+			return r.fail("min", "must be >= %d", r.min)
+		}
+		if r.hasMax && n > int64(r.max) {
+			return r.fail("max", "must be <= %d", r.max)
+		}
+
+	default:
+		if r.required && val.IsZero() {
+			return r.fail("required", "must me not empty")
+		}
+		switch val.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			if r.hasMin && val.Len() < r.min {
+				return r.fail("min", "len must be >= %d", r.min)
+			}
+			if r.hasMax && val.Len() > r.max {
+				return r.fail("max", "len must be <= %d", r.max)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fieldRules) checkEnum(val string) error {
+	if r.enum == nil {
+		return nil
+	}
+	for _, valid := range r.enum {
+		if val == valid {
+			return nil
+		}
+	}
+	return r.fail("enum", "must be one of [%s]", strings.Join(r.enum, ", "))
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
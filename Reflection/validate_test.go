@@ -0,0 +1,147 @@
+package convert
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// CreateParams - the same as in Codegen/api.go
+type CreateParams struct {
+	Login  string `apivalidator:"required,min=10"`
+	Name   string `apivalidator:"paramname=full_name"`
+	Status string `apivalidator:"enum=user|moderator|admin,default=user"`
+	Age    int    `apivalidator:"min=0,max=128"`
+}
+
+type Team struct {
+	Title   string         `apivalidator:"required"`
+	Members []CreateParams `apivalidator:"min=1,max=2"`
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		JsonData string
+		Expected CreateParams
+		Error    string
+	}{
+		{
+			`{"login":"mr.moderator","age":32,"status":"moderator","full_name":"Ivan_Ivanov"}`,
+			CreateParams{"mr.moderator", "Ivan_Ivanov", "moderator", 32}, "",
+		},
+		// messages are the ones of Codegen/main_test.go
+		{`{"age":32,"status":"moderator","full_name":"Ivan_Ivanov"}`, CreateParams{}, "login must me not empty"},
+		{`{"login":"new_m","age":32,"status":"moderator"}`, CreateParams{}, "login len must be >= 10"},
+		{`{"login":"new_moderator","age":"ten","status":"moderator"}`, CreateParams{}, "age must be int"},
+		{`{"login":"new_moderator","age":1.5}`, CreateParams{}, "age must be int"},
+		{`{"login":"new_moderator","status":"moderator"}`, CreateParams{}, "age must be int"},
+		{`{"login":"new_moderator","age":-1,"status":"moderator"}`, CreateParams{}, "age must be >= 0"},
+		{`{"login":"new_moderator","age":256,"status":"moderator"}`, CreateParams{}, "age must be <= 128"},
+		{`{"login":"new_moderator","age":32,"status":"adm"}`, CreateParams{}, "status must be one of [user, moderator, admin]"},
+		// status by default
+		{
+			`{"login":"new_moderator3","age":32,"full_name":"Ivan_Ivanov"}`,
+			CreateParams{"new_moderator3", "Ivan_Ivanov", "user", 32}, "",
+		},
+		// the first broken field in the order of the struct, like generated code
+		{`{"age":"ten","status":"adm"}`, CreateParams{}, "login must me not empty"},
+	}
+
+	for idx, item := range cases {
+		var tmpData interface{}
+		json.Unmarshal([]byte(item.JsonData), &tmpData)
+
+		result := CreateParams{}
+		err := Decode(tmpData, &result, Options{Validate: true})
+		if item.Error != "" {
+			var validationErr *ValidationError
+			if err == nil || err.Error() != item.Error || !errors.As(err, &validationErr) {
+				t.Errorf("[%d] expected error %q, got %v", idx, item.Error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] unexpected error: %v", idx, err)
+			continue
+		}
+		if !reflect.DeepEqual(item.Expected, result) {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+}
+
+func TestValidateCollect(t *testing.T) {
+	var tmpData interface{}
+	json.Unmarshal([]byte(`{"Members":[{"login":"short","age":"ten","status":"adm"},{"login":"new_moderator","age":32},{}]}`), &tmpData)
+
+	err := Decode(tmpData, &Team{}, Options{Validate: true, CollectErrors: true})
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+
+	result := map[string]string{}
+	for _, fieldErr := range errs {
+		result[fieldErr.Path] = fieldErr.Error()
+	}
+	expected := map[string]string{
+		"Members[0].Login":  "login len must be >= 10",
+		"Members[0].Status": "status must be one of [user, moderator, admin]",
+		"Members[0].Age":    "age must be int",
+		"Members[2].Login":  "login must me not empty",
+		"Members[2].Age":    "age must be int",
+		"Members":           "members len must be <= 2",
+		"Title":             "title must me not empty",
+	}
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+
+	// no validation without the option
+	if err := i2s(tmpData, &Team{}); err == nil {
+		t.Errorf("expected error for \"ten\"")
+	}
+	json.Unmarshal([]byte(`{"Members":[]}`), &tmpData)
+	if err := i2s(tmpData, &Team{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Renamed - paramname is for the handlers only, json names the field otherwise
+type Renamed struct {
+	Name string `json:"name" apivalidator:"paramname=full_name"`
+	Nick string `apivalidator:"paramname=nickname"`
+	Age  int
+}
+
+func TestParamName(t *testing.T) {
+	var tmpData interface{}
+	json.Unmarshal([]byte(`{"name":"json","full_name":"param","Nick":"field","nickname":"param","age":1}`), &tmpData)
+
+	cases := []struct {
+		Opts     Options
+		Expected Renamed
+	}{
+		{Options{}, Renamed{"json", "field", 1}},
+		{Options{Validate: true}, Renamed{"param", "param", 1}},
+	}
+	for idx, item := range cases {
+		result := Renamed{}
+		if err := Decode(tmpData, &result, item.Opts); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", idx, err)
+		}
+		if result != item.Expected {
+			t.Errorf("[%d] results not match\nGot:\n%#v\nExpected:\n%#v", idx, result, item.Expected)
+		}
+	}
+
+	out, err := s2i(&Renamed{"a", "b", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"name": "a", "Nick": "b", "Age": float64(1)}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("results not match\nGot:\n%#v\nExpected:\n%#v", out, expected)
+	}
+}